@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// recordPrefix is the name prefix of the record ConfigMap, the full name is the prefix followed by the run ID.
+	recordPrefix = "alpha-policy-convert-"
+	// recordObjectsKey is the key in the record ConfigMap that stores the created beta objects.
+	recordObjectsKey = "objects"
+	// recordPreviousKey is the key in the record ConfigMap that stores the previous version of the updated objects.
+	recordPreviousKey = "previous"
+)
+
+func applyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Convert and apply the beta policies to the cluster with server-side dry run and per-namespace confirmation.",
+		Long: `Apply converts the v1alpha1 policies and creates the beta policies in the cluster. The beta policies are first
+compared to the existing beta policies: identical policies are skipped, changed policies generated by a previous run
+are updated, and nothing is applied if any policy conflicts with a hand-authored policy unless --overwrite is set. All
+beta policies are then applied with server-side dry run and nothing is applied if any of them is rejected. The beta
+policies are finally applied namespace by namespace, each namespace requires a confirmation unless --yes is set. The
+applied beta policies are recorded in a ConfigMap in the istio-system namespace so that they could be rolled back
+exactly.`,
+		Example: `
+# Convert the v1alpha1 policies in the current cluster and apply the beta policies with confirmation per namespace:
+./convert apply
+
+# Convert the v1alpha1 policies in local files and apply the beta policies to the current cluster without confirmation:
+./convert apply --input alpha-policy.yaml --input k8s-services/ --yes
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, input := range inputFiles {
+				if input == stdinInput && !assumeYes {
+					return fmt.Errorf("--yes is required when reading input from stdin")
+				}
+			}
+			res, err := loadResources()
+			if err != nil {
+				return err
+			}
+			runID := newRunID()
+			outputs, err := convertAll(res, runID)
+			if err != nil {
+				return err
+			}
+			if snapshotFile != "" {
+				if err := writeSnapshot(snapshotFile, res); err != nil {
+					return err
+				}
+			}
+			client, err := newKubeClient(kubeconfig, configContext)
+			if err != nil {
+				log.Fatalf("failed to create kube client: %v", err)
+			}
+			return apply(client, runID, outputs, os.Stdin)
+		},
+	}
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "apply the beta policies in all namespaces without confirmation")
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "overwrite the existing beta policies that are hand-authored "+
+		"or converted from a different alpha policy, and create the beta policies that overlap with hand-authored ones")
+	cmd.Flags().StringVar(&snapshotFile, "snapshot", "", "save the v1alpha1 policies to the given file before applying "+
+		"so that they could be restored with the rollback command")
+	return cmd
+}
+
+// applyRecord records the beta objects applied by a single run of the apply command.
+type applyRecord struct {
+	RunID string
+	// Objects includes the beta objects created in the run.
+	Objects []converter.ObjectReference
+	// Previous includes the previous version of the beta objects updated in the run.
+	Previous []*unstructured.Unstructured
+	// saved is true once the record ConfigMap is created, it is then updated as more namespaces are applied.
+	saved bool
+}
+
+func (r *applyRecord) configMapName() string {
+	return recordPrefix + r.RunID
+}
+
+// newRunID returns the timestamp of the run with a random suffix so that the runs in the same second are different.
+func newRunID() string {
+	return time.Now().UTC().Format("20060102-150405") + "-" + utilrand.String(5)
+}
+
+// writeSnapshot writes the v1alpha1 policies in the resources to the file as multi-document YAML.
+func writeSnapshot(filename string, res *resources) error {
+	var data strings.Builder
+	for _, items := range [][]unstructured.Unstructured{res.policies, res.rbac} {
+		for _, item := range items {
+			out, err := yaml.Marshal(item.Object)
+			if err != nil {
+				return fmt.Errorf("failed to marshal %s %s/%s: %w", item.GetKind(), item.GetNamespace(), item.GetName(), err)
+			}
+			data.Write(out)
+			data.WriteString("---\n")
+		}
+	}
+	if err := ioutil.WriteFile(filename, []byte(data.String()), 0644); err != nil {
+		return fmt.Errorf("write snapshot to %s failed: %v", filename, err)
+	}
+	log.Printf("saved %d v1alpha1 policies to snapshot %s", len(res.policies)+len(res.rbac), filename)
+	return nil
+}
+
+// applyAction is the action to apply a generated beta object.
+type applyAction struct {
+	item *unstructured.Unstructured
+	diff *converter.ObjectDiff
+	// previous is the existing object to be updated, nil if the object is created.
+	previous *unstructured.Unstructured
+}
+
+func (a *applyAction) verb() string {
+	if a.previous != nil {
+		return "update"
+	}
+	return "create"
+}
+
+func apply(client *kubeClient, runID string, outputs []*converter.OutputPolicy, confirmInput io.Reader) error {
+	var generated []*converter.ObjectStruct
+	for _, out := range outputs {
+		generated = append(generated, out.ToObjects()...)
+	}
+	if len(generated) == 0 {
+		log.Printf("generated 0 beta policies, nothing to apply")
+		return nil
+	}
+	existing, err := client.listBeta()
+	if err != nil {
+		return err
+	}
+	diffs := converter.Diff(generated, existing)
+	printDiffs(diffs, false)
+
+	var conflicts []string
+	for _, diff := range diffs {
+		if diff.Status == converter.DiffConflicting {
+			conflicts = append(conflicts, fmt.Sprintf("%s: %s", diff.Object, diff.Reason))
+		}
+	}
+	if len(conflicts) != 0 && !overwrite {
+		return fmt.Errorf("found %d beta policies conflicting with existing policies, nothing is applied, "+
+			"fix the conflicts or use --overwrite to apply anyway: \n\t* %s", len(conflicts), strings.Join(conflicts, "\n\t* "))
+	}
+
+	actionsByNamespace := map[string][]*applyAction{}
+	var namespaces []string
+	total := 0
+	for i, obj := range generated {
+		diff := diffs[i]
+		if diff.Status == converter.DiffIdentical {
+			continue
+		}
+		item, err := toUnstructured(obj)
+		if err != nil {
+			return err
+		}
+		action := &applyAction{item: item, diff: diff}
+		if diff.SameName() {
+			// Update the existing object with the same name, either changed or overwritten with --overwrite.
+			if action.previous, err = client.getBeta(*diff.Existing); err != nil {
+				return fmt.Errorf("failed to get %s: %w", diff.Existing, err)
+			}
+			item.SetResourceVersion(action.previous.GetResourceVersion())
+		}
+		if _, found := actionsByNamespace[item.GetNamespace()]; !found {
+			namespaces = append(namespaces, item.GetNamespace())
+		}
+		actionsByNamespace[item.GetNamespace()] = append(actionsByNamespace[item.GetNamespace()], action)
+		total++
+	}
+	if total == 0 {
+		log.Printf("all %d beta policies are identical to the existing policies, nothing to apply", len(generated))
+		return nil
+	}
+	sort.Strings(namespaces)
+
+	// Dry run all objects first so that nothing is applied if any of them is rejected by the server.
+	var dryRunErrors []string
+	for _, ns := range namespaces {
+		for _, action := range actionsByNamespace[ns] {
+			if err := client.applyBeta(action, true); err != nil {
+				dryRunErrors = append(dryRunErrors, err.Error())
+			}
+		}
+	}
+	if len(dryRunErrors) != 0 {
+		return fmt.Errorf("server-side dry run failed for %d of %d beta policies, nothing is applied: \n\t* %s",
+			len(dryRunErrors), total, strings.Join(dryRunErrors, "\n\t* "))
+	}
+	log.Printf("server-side dry run succeeded for %d beta policies in %d namespaces", total, len(namespaces))
+
+	record := &applyRecord{RunID: runID}
+	reader := bufio.NewReader(confirmInput)
+	for _, ns := range namespaces {
+		actions := actionsByNamespace[ns]
+		if !assumeYes && !confirmNamespace(reader, ns, actions) {
+			log.Printf("SKIPPED applying %d beta policies in namespace %s", len(actions), ns)
+			continue
+		}
+		for _, action := range actions {
+			if err := client.applyBeta(action, false); err != nil {
+				// Record what is already applied so that it could still be rolled back.
+				if recordErr := client.saveRecord(record); recordErr != nil {
+					log.Printf("failed to save the record of run %s: %v", record.RunID, recordErr)
+				}
+				return err
+			}
+			if action.previous != nil {
+				record.Previous = append(record.Previous, action.previous)
+			} else {
+				record.Objects = append(record.Objects, objectReference(action.item))
+			}
+		}
+		if err := client.saveRecord(record); err != nil {
+			return err
+		}
+		log.Printf("APPLIED  %d beta policies in namespace %s", len(actions), ns)
+	}
+
+	if len(record.Objects) == 0 && len(record.Previous) == 0 {
+		log.Printf("applied 0 beta policies")
+		return nil
+	}
+	log.Printf("created %d and updated %d beta policies in run %s, recorded in ConfigMap %s/%s",
+		len(record.Objects), len(record.Previous), record.RunID, istioNamespace, record.configMapName())
+	return nil
+}
+
+// printDiffs logs the status of each generated beta object compared to the existing objects, the spec difference is
+// only logged if verbose is true.
+func printDiffs(diffs []*converter.ObjectDiff, verbose bool) {
+	counts := map[converter.DiffStatus]int{}
+	for _, diff := range diffs {
+		counts[diff.Status]++
+		line := fmt.Sprintf("%-11s %s", diff.Status, diff.Object)
+		if diff.Reason != "" {
+			line = fmt.Sprintf("%s, %s", line, diff.Reason)
+		}
+		if verbose && diff.Diff != "" {
+			line = fmt.Sprintf("%s, diff (-existing +generated):\n%s", line, diff.Diff)
+		}
+		log.Print(line)
+	}
+	log.Printf("compared %d beta policies to the existing policies: %d new, %d changed, %d identical, %d conflicting",
+		len(diffs), counts[converter.DiffNew], counts[converter.DiffChanged], counts[converter.DiffIdentical],
+		counts[converter.DiffConflicting])
+}
+
+// confirmNamespace asks the user to confirm applying the beta policies in the namespace.
+func confirmNamespace(reader *bufio.Reader, namespace string, actions []*applyAction) bool {
+	fmt.Fprintf(os.Stderr, "The following beta policies will be applied in namespace %s:\n", namespace)
+	for _, action := range actions {
+		fmt.Fprintf(os.Stderr, "  - %s %s %s (%s)\n", action.verb(), action.item.GetKind(), action.item.GetName(), action.diff.Status)
+	}
+	fmt.Fprintf(os.Stderr, "Apply %d beta policies in namespace %s? [y/N]: ", len(actions), namespace)
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func toUnstructured(obj *converter.ObjectStruct) (*unstructured.Unstructured, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s %s/%s: %w", obj.Kind, obj.Namespace, obj.Name, err)
+	}
+	item := &unstructured.Unstructured{}
+	if err := item.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s %s/%s: %w", obj.Kind, obj.Namespace, obj.Name, err)
+	}
+	return item, nil
+}
+
+func objectReference(item *unstructured.Unstructured) converter.ObjectReference {
+	return converter.ObjectReference{
+		APIVersion: item.GetAPIVersion(),
+		Kind:       item.GetKind(),
+		Namespace:  item.GetNamespace(),
+		Name:       item.GetName(),
+	}
+}
+
+// applyBeta creates or updates the beta policy, with server-side dry run if dryRun is true.
+func (kc *kubeClient) applyBeta(action *applyAction, dryRun bool) error {
+	item := action.item
+	gvr, err := betaResource(item.GroupVersionKind())
+	if err != nil {
+		return err
+	}
+	client := kc.dynamicClient.Resource(gvr).Namespace(item.GetNamespace())
+	if action.previous != nil {
+		options := metav1.UpdateOptions{}
+		if dryRun {
+			options.DryRun = []string{metav1.DryRunAll}
+		}
+		_, err = client.Update(context.TODO(), item, options)
+	} else {
+		options := metav1.CreateOptions{}
+		if dryRun {
+			options.DryRun = []string{metav1.DryRunAll}
+		}
+		_, err = client.Create(context.TODO(), item, options)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s %s %s/%s: %w", action.verb(), item.GetKind(), item.GetNamespace(), item.GetName(), err)
+	}
+	return nil
+}
+
+// saveRecord creates the ConfigMap that records the beta objects created in the run, or updates it if it is already
+// created in the run. An existing ConfigMap of another run with the same ID is an error. Nothing is saved until any
+// beta object is applied so that a failed run leaves no empty record to roll back.
+func (kc *kubeClient) saveRecord(record *applyRecord) error {
+	if !record.saved && len(record.Objects) == 0 && len(record.Previous) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(record.Objects)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the record of run %s: %w", record.RunID, err)
+	}
+	var previous []map[string]interface{}
+	for _, item := range record.Previous {
+		item = item.DeepCopy()
+		unstructured.RemoveNestedField(item.Object, "metadata", "managedFields")
+		previous = append(previous, item.Object)
+	}
+	previousData, err := json.Marshal(previous)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the record of run %s: %w", record.RunID, err)
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      record.configMapName(),
+			Namespace: istioNamespace,
+			Labels:    map[string]string{converter.RunLabel: record.RunID},
+		},
+		Data: map[string]string{recordObjectsKey: string(data), recordPreviousKey: string(previousData)},
+	}
+	configMaps := kc.kubeClient.CoreV1().ConfigMaps(istioNamespace)
+	if record.saved {
+		_, err = configMaps.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	} else {
+		// Never overwrite the record of another run, it is needed to roll back that run.
+		_, err = configMaps.Create(context.TODO(), cm, metav1.CreateOptions{})
+		if kerr.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to save the record of run %s: ConfigMap %s/%s already exists for another run", record.RunID, istioNamespace, cm.Name)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save the record of run %s in ConfigMap %s/%s: %w", record.RunID, istioNamespace, cm.Name, err)
+	}
+	record.saved = true
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// backupFormatVersion is the version of the backup archive format, increase it on incompatible changes.
+	backupFormatVersion = "v1"
+	// backupManifestFile and backupResourcesFile are the files in the backup archive.
+	backupManifestFile  = "manifest.yaml"
+	backupResourcesFile = "resources.yaml"
+)
+
+// backupManifest describes the content of the backup archive.
+type backupManifest struct {
+	FormatVersion string         `json:"formatVersion"`
+	ToolVersion   string         `json:"toolVersion,omitempty"`
+	CreatedAt     string         `json:"createdAt"`
+	Context       string         `json:"context,omitempty"`
+	RootNamespace string         `json:"rootNamespace"`
+	Resources     map[string]int `json:"resources"`
+}
+
+func backupCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Backup all v1alpha1 policies and the resources needed to convert them to a versioned archive.",
+		Long: `Backup saves every v1alpha1 authentication and RBAC policy in the cluster, together with the Services (and the Pods
+selected by the Services) referenced by the policies, the DestinationRules, the names of the Namespaces and the istio
+mesh ConfigMap, to a self-contained versioned archive. The archive could be used later with --input to convert the
+policies offline, or with rollback --restore to restore the v1alpha1 policies, e.g. after the alpha CRDs are removed in
+the upgrade. The backup always includes all namespaces, --namespace is ignored.`,
+		Example: `
+# Backup the v1alpha1 policies in the current cluster:
+./convert backup --output alpha-backup.tar.gz
+
+# Convert the v1alpha1 policies in the backup offline:
+./convert --input alpha-backup.tar.gz > beta-policy.yaml
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The backup must be complete to convert or restore offline, the scope of the migration is ignored.
+			if len(namespaces) != 0 {
+				log.Printf("--namespace %s is ignored, the backup includes all namespaces", strings.Join(namespaces, ","))
+				namespaces = nil
+			}
+			client, err := newKubeClient(kubeconfig, configContext)
+			if err != nil {
+				log.Fatalf("failed to create kube client: %v", err)
+			}
+			return backup(client, backupFile)
+		},
+	}
+	cmd.Flags().StringVarP(&backupFile, "output", "o", fmt.Sprintf("alpha-backup-%s.tar.gz", newRunID()),
+		"the file to write the backup archive")
+	return cmd
+}
+
+func backup(client *kubeClient, filename string) error {
+	res, err := client.load(true)
+	if err != nil {
+		return err
+	}
+
+	manifest := &backupManifest{
+		FormatVersion: backupFormatVersion,
+		ToolVersion:   version,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		Context:       configContext,
+		RootNamespace: res.rootNamespace,
+		Resources:     map[string]int{},
+	}
+	var objects []map[string]interface{}
+	addTyped := func(kind string, obj runtime.Object) error {
+		data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %w", kind, err)
+		}
+		item := unstructured.Unstructured{Object: data}
+		item.SetAPIVersion("v1")
+		item.SetKind(kind)
+		objects = append(objects, item.Object)
+		manifest.Resources[kind]++
+		return nil
+	}
+	for _, items := range [][]unstructured.Unstructured{res.policies, res.rbac, res.destinationRules} {
+		for _, item := range items {
+			objects = append(objects, item.Object)
+			manifest.Resources[item.GetKind()]++
+		}
+	}
+	for i := range res.services.Items {
+		if err := addTyped("Service", &res.services.Items[i]); err != nil {
+			return err
+		}
+	}
+	for i := range res.pods {
+		if err := addTyped("Pod", &res.pods[i]); err != nil {
+			return err
+		}
+	}
+	// The namespaces are needed to copy the mesh level policies offline, only the referenced services are saved.
+	for _, ns := range res.namespaces {
+		if err := addTyped("Namespace", &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}); err != nil {
+			return err
+		}
+	}
+	if client.meshConfigMap != nil {
+		if err := addTyped("ConfigMap", client.meshConfigMap); err != nil {
+			return err
+		}
+	}
+
+	if err := writeArchive(filename, manifest, objects); err != nil {
+		return err
+	}
+	log.Printf("saved backup %s: %v", filename, manifest.Resources)
+	return nil
+}
+
+func writeArchive(filename string, manifest *backupManifest, objects []map[string]interface{}) error {
+	manifestData, err := yaml.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+	var resourcesData strings.Builder
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("failed to marshal resource: %w", err)
+		}
+		resourcesData.Write(data)
+		resourcesData.WriteString("---\n")
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create backup %s: %w", filename, err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{name: backupManifestFile, data: manifestData},
+		{name: backupResourcesFile, data: []byte(resourcesData.String())},
+	} {
+		header := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write backup %s: %w", filename, err)
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return fmt.Errorf("failed to write backup %s: %w", filename, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write backup %s: %w", filename, err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write backup %s: %w", filename, err)
+	}
+	return f.Close()
+}
+
+// isArchive returns true if the file is a backup archive.
+func isArchive(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// readArchive reads the resources in the backup archive, the archive format version must be supported.
+func readArchive(path string) ([]unstructured.Unstructured, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup %s: %w", path, err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup %s: %w", path, err)
+	}
+	tr := tar.NewReader(gz)
+
+	var manifest *backupManifest
+	var resourcesData []byte
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup %s: %w", path, err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s in backup %s: %w", header.Name, path, err)
+		}
+		switch header.Name {
+		case backupManifestFile:
+			manifest = &backupManifest{}
+			if err := yaml.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("failed to parse manifest in backup %s: %w", path, err)
+			}
+		case backupResourcesFile:
+			resourcesData = data
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("invalid backup %s: missing %s", path, backupManifestFile)
+	}
+	if manifest.FormatVersion != backupFormatVersion {
+		return nil, fmt.Errorf("unsupported backup %s: format version %q, want %q", path, manifest.FormatVersion, backupFormatVersion)
+	}
+	log.Printf("reading backup %s created at %s", path, manifest.CreatedAt)
+	return readObjects(strings.NewReader(string(resourcesData)), path)
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// resources includes all the resources needed by the conversion, either read from the cluster or from input files.
+type resources struct {
+	rootNamespace string
+	// meshConfig includes the mesh wide authentication settings in the mesh config, nil if not found.
+	meshConfig *converter.MeshConfig
+	services   *corev1.ServiceList
+	// namespaces includes all namespaces in the cluster (or found in the input), the services are only loaded partially.
+	namespaces []string
+	// pods includes the pods used to resolve the named target port of the services and to detect the overlapping
+	// PeerAuthentications.
+	pods     []corev1.Pod
+	policies []unstructured.Unstructured
+	rbac     []unstructured.Unstructured
+	// destinationRules includes the DestinationRules checked against the generated PeerAuthentications.
+	destinationRules []unstructured.Unstructured
+}
+
+// newConverter creates the converter with the mesh settings and services in the resources.
+func newConverter(res *resources) *converter.Converter {
+	cvt := converter.NewConverter(res.rootNamespace, res.services)
+	cvt.Service.AddPods(res.pods)
+	cvt.MeshConfig = res.meshConfig
+	cvt.Service.Namespaces = res.namespaces
+	return cvt
+}
+
+// referencedServices returns the services referenced by the alpha policies, the mesh config and the DestinationRules
+// in the resources.
+func referencedServices(res *resources) (*converter.ServiceReferences, error) {
+	var policies []*converter.InputPolicy
+	for _, item := range res.policies {
+		policy, err := converter.ConvertToPolicy(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert resource to authentication policy: %v", err)
+		}
+		policies = append(policies, policy)
+	}
+	rbac, err := converter.ConvertToRbac(res.rbac)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert resource to RBAC policy: %v", err)
+	}
+	var rules []*converter.InputDestinationRule
+	for _, item := range res.destinationRules {
+		rule, err := converter.ConvertToDestinationRule(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert resource to destination rule: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+	return converter.ReferencedServices(res.rootNamespace, res.meshConfig, policies, rbac, rules), nil
+}
+
+func convert(res *resources) error {
+	outputs, err := convertAll(res, newRunID())
+	if err != nil {
+		return err
+	}
+
+	betaPolicyOutput := map[string]*strings.Builder{}
+	for _, out := range outputs {
+		key := "all"
+		if perNamespace != "" {
+			key = out.Namespace
+		}
+		if _, ok := betaPolicyOutput[key]; !ok {
+			betaPolicyOutput[key] = &strings.Builder{}
+		}
+		betaPolicyOutput[key].WriteString(out.ToYAML())
+	}
+	if len(betaPolicyOutput) == 0 {
+		fmt.Printf("generated 0 beta policies")
+		return nil
+	}
+	if perNamespace != "" {
+		for ns, out := range betaPolicyOutput {
+			filename := fmt.Sprintf("%s/ns-%s.yaml", perNamespace, ns)
+			log.Printf("Writing to %s for namespace %s", filename, ns)
+			err := ioutil.WriteFile(filename, []byte(out.String()), 0644)
+			if err != nil {
+				return fmt.Errorf("write to %s failed: %v", filename, err)
+			}
+		}
+	} else {
+		fmt.Printf(betaPolicyOutput["all"].String())
+	}
+	return nil
+}
+
+// convertAll converts all the alpha policies in the resources and returns the converted beta policies of the policies
+// converted successfully, an error is returned if any policy failed to convert unless --ignore-error is set. The beta
+// policies are labeled with the run ID so that they could be rolled back later.
+func convertAll(res *resources, runID string) (outputs []*converter.OutputPolicy, err error) {
+	if err := converter.ValidateAPIVersion(outputAPIVersion); err != nil {
+		return nil, err
+	}
+	cvt := newConverter(res)
+	suppressed, err := parseSuppressions(suppressCodes)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := newScope()
+	if err != nil {
+		return nil, err
+	}
+	hasError := false
+	var rpt *report
+	if reportFormat != "" {
+		rpt = newReport()
+		defer func() {
+			// Always write the report so that the failed conversion is also recorded.
+			if reportErr := rpt.write(reportFormat, reportFile); reportErr != nil && err == nil {
+				err = reportErr
+			}
+		}()
+	}
+	// suppress applies the suppressions of the alpha policy to the summary.
+	suppress := func(kind, namespace, name string, annotations map[string]string, summary *converter.ResultSummary) {
+		codes, err := suppressed.codesFor(namespace, name, annotations)
+		if err != nil {
+			summary.Errors = append(summary.Errors, &converter.Issue{
+				Code:     converter.CodeInvalidSuppression,
+				Severity: converter.SeverityError,
+				Field:    "metadata.annotations." + suppressAnnotation,
+				Message:  err.Error(),
+			})
+		} else {
+			summary.Suppress(codes)
+		}
+		if cnt := len(summary.Suppressed); cnt != 0 {
+			suppressedOutput := fmt.Sprintf("\n\t* %s", joinIssues(summary.Suppressed, "\n\t* "))
+			log.Printf("SUPPRESS converting %s %s/%s, suppressed %d issues: %s", kind, namespace, name, cnt, suppressedOutput)
+		}
+	}
+	// check logs the result of the alpha policy and returns false if it has any error.
+	check := func(kind, namespace, name string, summary *converter.ResultSummary) bool {
+		if cnt := len(summary.Errors); cnt != 0 {
+			errorOutput := fmt.Sprintf("\n\t* %s", joinIssues(summary.Errors, "\n\t* "))
+			log.Printf("FAILED  converting %s %s/%s, found %d errors: %s", kind, namespace, name, cnt, errorOutput)
+			hasError = true
+			return false
+		}
+		if cnt := len(summary.Warnings); cnt != 0 {
+			warningOutput := fmt.Sprintf("\n\t* %s", joinIssues(summary.Warnings, "\n\t* "))
+			log.Printf("SUCCESS converting %s %s/%s, found %d warnings: %s", kind, namespace, name, cnt, warningOutput)
+		} else {
+			log.Printf("SUCCESS converting %s %s/%s", kind, namespace, name)
+		}
+		return true
+	}
+	// annotations and skipped are keyed by the reference of the alpha policy to attribute the issues found later.
+	annotations := map[string]map[string]string{}
+	skipped := map[string]bool{}
+	collect := func(kind, namespace, name string, itemAnnotations map[string]string, output []*converter.OutputPolicy,
+		summary *converter.ResultSummary) {
+		annotations[sourceKey(kind, namespace, name)] = itemAnnotations
+		suppress(kind, namespace, name, itemAnnotations, summary)
+		if rpt != nil {
+			rpt.add(kind, namespace, name, output, summary)
+		}
+		if !check(kind, namespace, name, summary) {
+			return
+		}
+		for _, out := range output {
+			out.Labels = map[string]string{converter.RunLabel: runID}
+		}
+		outputs = append(outputs, output...)
+	}
+	skip := func(kind, namespace, name string) {
+		skipped[sourceKey(kind, namespace, name)] = true
+		log.Printf("SKIPPED converting %s %s/%s, out of scope", kind, namespace, name)
+		if rpt != nil {
+			rpt.addOutOfScope(kind, namespace, name)
+		}
+	}
+	// attribute adds the issues found in the passes over all beta policies to the alpha policies causing them, so that
+	// they could be suppressed per policy. The issues of the alpha policies out of scope are ignored.
+	attribute := func(results converter.SourceResults) {
+		for _, source := range results.Sources() {
+			key := sourceKey(source.Kind, source.Namespace, source.Name)
+			if skipped[key] {
+				continue
+			}
+			summary := results[source]
+			suppress(source.Kind, source.Namespace, source.Name, annotations[key], summary)
+			if rpt != nil {
+				rpt.addIssues(source.Kind, source.Namespace, source.Name, summary)
+			}
+			check(source.Kind, source.Namespace, source.Name, summary)
+		}
+	}
+
+	var meshPolicy *converter.InputPolicy
+	for _, item := range res.policies {
+		policy, err := converter.ConvertToPolicy(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert resource to authentication policy: %v", err)
+		}
+		if item.GetKind() == "MeshPolicy" {
+			meshPolicy = policy
+		}
+		output, summary := cvt.Convert(policy)
+		if !sc.includes(item.GetKind(), item.GetNamespace(), item.GetName(), item.GetLabels()) {
+			// The beta policies out of scope are still needed to resolve the precedence, they are removed at the end.
+			skip(item.GetKind(), item.GetNamespace(), item.GetName())
+			outputs = append(outputs, output...)
+			continue
+		}
+		collect(item.GetKind(), item.GetNamespace(), item.GetName(), item.GetAnnotations(), output, summary)
+	}
+	// Convert the authPolicy in the mesh config if there is no MeshPolicy.
+	if output, summary := cvt.ConvertMeshConfig(meshPolicy); len(output) != 0 || len(summary.Errors) != 0 || len(summary.Warnings) != 0 {
+		if sc.includes("ConfigMap", res.meshConfig.Namespace, res.meshConfig.Name, nil) {
+			collect("ConfigMap", res.meshConfig.Namespace, res.meshConfig.Name, nil, output, summary)
+		} else {
+			skip("ConfigMap", res.meshConfig.Namespace, res.meshConfig.Name)
+			outputs = append(outputs, output...)
+		}
+	}
+	// Adjust the beta policies so that the effective behavior on each workload follows the alpha precedence.
+	outputs, results := cvt.PreservePrecedence(outputs)
+	attribute(results)
+	// Merge or report the PeerAuthentications converted from different policies that select the same pods.
+	outputs, results = cvt.MergePeerAuthentications(outputs)
+	attribute(results)
+	// Check the client TLS settings in the DestinationRules against the generated PeerAuthentications.
+	for _, item := range res.destinationRules {
+		rule, err := converter.ConvertToDestinationRule(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert resource to destination rule: %v", err)
+		}
+		// The DestinationRule is applied in the client namespace, only check it if its host is a service in scope.
+		if !sc.includesAnyNamespace(cvt.DestinationRuleNamespaces(rule)) {
+			continue
+		}
+		if summary := cvt.CheckDestinationRule(rule, outputs); len(summary.Errors) != 0 || len(summary.Warnings) != 0 {
+			collect(item.GetKind(), item.GetNamespace(), item.GetName(), item.GetAnnotations(), nil, summary)
+		}
+	}
+
+	rbac, err := converter.ConvertToRbac(res.rbac)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert resource to RBAC policy: %v", err)
+	}
+	rbacAnnotations := map[string]map[string]string{}
+	rbacLabels := map[string]map[string]string{}
+	for _, item := range res.rbac {
+		rbacAnnotations[item.GetKind()+"/"+item.GetNamespace()+"/"+item.GetName()] = item.GetAnnotations()
+		rbacLabels[item.GetKind()+"/"+item.GetNamespace()+"/"+item.GetName()] = item.GetLabels()
+	}
+	if config := rbac.Config(); config != nil {
+		output, summary := cvt.ConvertRbacConfig(rbac)
+		key := config.Kind + "/" + config.Namespace + "/" + config.Name
+		if sc.includes(config.Kind, config.Namespace, config.Name, rbacLabels[key]) {
+			collect(config.Kind, config.Namespace, config.Name, rbacAnnotations[key], output, summary)
+		} else {
+			skip(config.Kind, config.Namespace, config.Name)
+		}
+	} else if len(rbac.Bindings) != 0 {
+		_, summary := cvt.ConvertRbacConfig(rbac)
+		collect("RBAC", "", "", nil, nil, summary)
+	}
+	for _, binding := range rbac.Bindings {
+		output, summary := cvt.ConvertRbacBinding(rbac, binding)
+		key := "ServiceRoleBinding/" + binding.Namespace + "/" + binding.Name
+		if !sc.includes("ServiceRoleBinding", binding.Namespace, binding.Name, rbacLabels[key]) {
+			skip("ServiceRoleBinding", binding.Namespace, binding.Name)
+			continue
+		}
+		collect("ServiceRoleBinding", binding.Namespace, binding.Name, rbacAnnotations[key], output, summary)
+	}
+
+	// Remove the beta policies in the namespaces out of scope or generated from the alpha policies out of scope, the
+	// mesh level beta policies are copied to the namespaces in scope if the root namespace is out of scope.
+	if sc.restricted() {
+		var kept, localized []*converter.OutputPolicy
+		for _, out := range outputs {
+			if sc.includesOutput(out) {
+				kept = append(kept, out)
+				continue
+			}
+			if rpt != nil {
+				rpt.dropOutput(out.Source, out)
+			}
+			if sc.includesSource(out) {
+				localized = append(localized, cvt.LocalizeMeshLevel(out, sc.namespacesIn(res), outputs)...)
+			}
+		}
+		log.Printf("removed %d beta policies out of scope, copied %d mesh level beta policies to the namespaces in scope",
+			len(outputs)-len(kept), len(localized))
+		outputs = append(kept, localized...)
+	}
+
+	if shadow {
+		shadowed := converter.ShadowJWTRequirements(outputs)
+		log.Printf("generated %d AuthorizationPolicies requiring JWT in dry-run mode, enforce them with the promote "+
+			"command after the observation window", len(shadowed))
+	}
+	// Generate the EnvoyFilters after the scope is applied so that only the workloads in scope are touched.
+	if preserve401 {
+		filters, results := cvt.PreserveUnauthorized(outputs)
+		for _, filter := range filters {
+			filter.Labels = map[string]string{converter.RunLabel: runID}
+			if rpt != nil {
+				rpt.addOutput(filter.Source, filter)
+			}
+		}
+		outputs = append(outputs, filters...)
+		attribute(results)
+	}
+	// Set the output API version at the end as the targetRefs are only used in the generated objects.
+	attribute(cvt.UseAPIVersion(outputs, outputAPIVersion))
+
+	if hasError {
+		if ignoreError {
+			log.Printf("Found errors but ignored with --ignore-error, the converted policies may not work as expected")
+		} else {
+			// TODO: add a link to the istio.io conversion documentation.
+			return nil, fmt.Errorf("conversion failed, found errors during conversion, please fix errors and re-run the tool again")
+		}
+	}
+	log.Printf("generated %d beta policies with run ID %s", len(outputs), runID)
+	return outputs, nil
+}
+
+// sourceKey returns the key of the alpha policy in the same format as the converter.ObjectReference.
+func sourceKey(kind, namespace, name string) string {
+	return converter.ObjectReference{Kind: kind, Namespace: namespace, Name: name}.String()
+}
+
+func joinIssues(issues []*converter.Issue, sep string) string {
+	var ret []string
+	for _, issue := range issues {
+		ret = append(ret, issue.String())
+	}
+	return strings.Join(ret, sep)
+}
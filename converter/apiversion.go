@@ -0,0 +1,108 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Output API versions of the security.istio.io policies, the EnvoyFilter is always generated in networking.istio.io/v1alpha3.
+const (
+	APIVersionV1beta1 = "v1beta1"
+	APIVersionV1      = "v1"
+)
+
+// WaypointLabel is the label on the service whose traffic is handled by a waypoint proxy in ambient mode.
+const WaypointLabel = "istio.io/use-waypoint"
+
+// WaypointSuffix is appended to the name of the copy of the policy attached to the waypoint with targetRefs.
+const WaypointSuffix = "-waypoint"
+
+// TargetRef references the resource the policy is attached to instead of the workload selector, it is only supported
+// by the RequestAuthentication and AuthorizationPolicy in security.istio.io/v1.
+type TargetRef struct {
+	Group string `json:"group"`
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+}
+
+// ValidateAPIVersion returns an error if the output API version is not supported.
+func ValidateAPIVersion(version string) error {
+	switch version {
+	case "", APIVersionV1beta1, APIVersionV1:
+		return nil
+	}
+	return fmt.Errorf("unsupported output API version %q, must be %s or %s", version, APIVersionV1beta1, APIVersionV1)
+}
+
+// OutputGVK returns the GroupVersionKind of the generated object in the output API version, only the security.istio.io
+// kinds are changed, empty version means v1beta1.
+func OutputGVK(gvk schema.GroupVersionKind, version string) schema.GroupVersionKind {
+	if gvk.Group == AuthorizationPolicyGVK.Group && version != "" {
+		gvk.Version = version
+	}
+	return gvk
+}
+
+// UseAPIVersion sets the output API version of the beta policies. In v1, the RequestAuthentication and
+// AuthorizationPolicy selecting exactly the workloads of the services handled by a waypoint proxy are also attached to
+// the services with targetRefs in a copy named with WaypointSuffix, as the waypoint does not enforce the policies with
+// workload selector. The policies with selector are kept for the traffic bypassing the waypoint (e.g. from the ingress
+// gateway or the pods addressing the workloads directly). The PeerAuthentication has no targetRef and always uses the
+// workload selector, the Gateway API gateways are not detected and their policies are never attached with targetRefs.
+// The issues are attributed to the alpha policy of each beta policy.
+func (mc *Converter) UseAPIVersion(outputs []*OutputPolicy, version string) SourceResults {
+	results := SourceResults{}
+	for _, output := range outputs {
+		output.APIVersion = version
+		if version != APIVersionV1 || (output.RequestAuthN == nil && output.Authz == nil) {
+			continue
+		}
+		labels := output.Authz.GetSelector().GetMatchLabels()
+		if output.Authz == nil {
+			labels = output.RequestAuthN.GetSelector().GetMatchLabels()
+		}
+		services := mc.Service.waypointServices(output.Namespace, labels)
+		if len(services) == 0 {
+			continue
+		}
+		output.TargetRefs = nil
+		for _, svc := range services {
+			output.TargetRefs = append(output.TargetRefs, TargetRef{Kind: "Service", Name: svc})
+		}
+		results.of(output.Source).addWarning(CodeTargetRefGenerated, "", fmt.Sprintf("%s/%s is also attached to the waypoint of the "+
+			"services [%s] with targetRefs in %s%s, please check the ports in the rules as the copy is enforced by the "+
+			"waypoint instead of the workloads", output.Namespace, output.Name, strings.Join(services, ", "),
+			output.Name, WaypointSuffix))
+	}
+	return results
+}
+
+// waypointServices returns the names of the services handled by a waypoint proxy in the namespace that select exactly
+// the labels sorted by name, nil if the labels are empty.
+func (ss *ServiceStore) waypointServices(namespace string, labels map[string]string) []string {
+	if len(labels) == 0 {
+		return nil
+	}
+	var ret []string
+	for _, svc := range ss.servicesInNamespace(namespace, nil) {
+		if waypoint := svc.Labels[WaypointLabel]; waypoint == "" || waypoint == "none" {
+			continue
+		}
+		if reflect.DeepEqual(svc.Spec.Selector, labels) {
+			ret = append(ret, svc.Name)
+		}
+	}
+	return ret
+}
+
+// targetRefsToList converts the targetRefs to the JSON types of the spec.
+func targetRefsToList(refs []TargetRef) []interface{} {
+	var ret []interface{}
+	for _, ref := range refs {
+		ret = append(ret, map[string]interface{}{"group": ref.Group, "kind": ref.Kind, "name": ref.Name})
+	}
+	return ret
+}
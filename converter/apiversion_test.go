@@ -0,0 +1,137 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestConverter_UseAPIVersion(t *testing.T) {
+	svcList := &corev1.ServiceList{
+		Items: []corev1.Service{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "httpbin", Namespace: "foo", Labels: map[string]string{WaypointLabel: "waypoint"}},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "httpbin"},
+					Ports:    []corev1.ServicePort{{Port: 8000, TargetPort: intstr.FromInt(80)}},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "productpage", Namespace: "foo", Labels: map[string]string{WaypointLabel: "none"}},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "productpage"},
+					Ports:    []corev1.ServicePort{{Port: 9080}},
+				},
+			},
+		},
+	}
+	cases := []struct {
+		name           string
+		service        string
+		version        string
+		wantAPIVersion string
+		wantTargetRefs bool
+	}{
+		{
+			name:           "v1beta1",
+			service:        "httpbin",
+			version:        APIVersionV1beta1,
+			wantAPIVersion: "security.istio.io/v1beta1",
+		},
+		{
+			name:           "v1-waypoint",
+			service:        "httpbin",
+			version:        APIVersionV1,
+			wantAPIVersion: "security.istio.io/v1",
+			wantTargetRefs: true,
+		},
+		{
+			name:           "v1-no-waypoint",
+			service:        "productpage",
+			version:        APIVersionV1,
+			wantAPIVersion: "security.istio.io/v1",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := NewConverter("istio-system", svcList)
+			outputs, result := mc.Convert(inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: jwt
+  namespace: foo
+spec:
+  targets:
+  - name: `+tc.service+`
+  peers:
+  - mtls: {}
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+  principalBinding: USE_ORIGIN
+`))
+			if len(result.Errors) != 0 {
+				t.Fatalf("want no error but got %v", result.Errors)
+			}
+			results := mc.UseAPIVersion(outputs, tc.version)
+			// The warning is attributed to the alpha policy.
+			summary := results[ObjectReference{APIVersion: "authentication.istio.io/v1alpha1", Kind: "Policy", Namespace: "foo", Name: "jwt"}]
+			if gotWarning := len(results) == 1 && summary != nil && len(summary.Warnings) == 1 &&
+				summary.Warnings[0].Code == CodeTargetRefGenerated; gotWarning != tc.wantTargetRefs {
+				t.Errorf("want TARGET_REF_GENERATED warning %v but got %v", tc.wantTargetRefs, results.Summary().Warnings)
+			}
+
+			var objects []*ObjectStruct
+			for _, out := range outputs {
+				objects = append(objects, out.ToObjects()...)
+			}
+			wantObjects := 3
+			if tc.wantTargetRefs {
+				wantObjects = 5
+			}
+			if len(objects) != wantObjects {
+				t.Fatalf("want %d objects but got %d", wantObjects, len(objects))
+			}
+			var gotWaypoint []string
+			for _, obj := range objects {
+				if obj.APIVersion != tc.wantAPIVersion {
+					t.Errorf("want %s in %s but got %s", tc.wantAPIVersion, obj.Kind, obj.APIVersion)
+				}
+				_, gotSelector := obj.Spec["selector"]
+				gotTargetRefs, _ := obj.Spec["targetRefs"].([]interface{})
+				if obj.GetName() == "jwt-"+tc.service {
+					if !gotSelector || gotTargetRefs != nil {
+						t.Errorf("want selector in %s but got %v", obj.Kind, obj.Spec)
+					}
+					continue
+				}
+				gotWaypoint = append(gotWaypoint, obj.Kind)
+				want := []interface{}{map[string]interface{}{"group": "", "kind": "Service", "name": "httpbin"}}
+				if obj.GetName() != "jwt-httpbin"+WaypointSuffix || gotSelector || !reflect.DeepEqual(gotTargetRefs, want) {
+					t.Errorf("want targetRefs %v in %s but got %s: %v", want, obj.Kind, obj.GetName(), obj.Spec)
+				}
+			}
+			if tc.wantTargetRefs && !reflect.DeepEqual(gotWaypoint, []string{"RequestAuthentication", "AuthorizationPolicy"}) {
+				t.Errorf("want the waypoint copy of RequestAuthentication and AuthorizationPolicy but got %v", gotWaypoint)
+			}
+		})
+	}
+}
+
+func TestOutputGVK(t *testing.T) {
+	if got := OutputGVK(AuthorizationPolicyGVK, APIVersionV1); got.Version != "v1" || got.Kind != AuthorizationPolicyGVK.Kind {
+		t.Errorf("want AuthorizationPolicy in v1 but got %v", got)
+	}
+	if got := OutputGVK(EnvoyFilterGVK, APIVersionV1); got != EnvoyFilterGVK {
+		t.Errorf("want EnvoyFilter unchanged but got %v", got)
+	}
+	if got := OutputGVK(PeerAuthenticationGVK, ""); got != PeerAuthenticationGVK {
+		t.Errorf("want PeerAuthentication unchanged but got %v", got)
+	}
+}
@@ -4,15 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 
 	"github.com/gogo/protobuf/jsonpb"
 	"github.com/gogo/protobuf/proto"
 	authnpb "istio.io/api/authentication/v1alpha1"
+	networkingpb "istio.io/api/networking/v1alpha3"
 	betapb "istio.io/api/security/v1beta1"
 	commonpb "istio.io/api/type/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/yaml"
 )
 
@@ -25,24 +28,27 @@ const (
 	Permissive mTLSMode = 2
 )
 
-// ResultSummary includes the conversion summary.
-type ResultSummary struct {
-	Errors []string
-}
-
-func (r *ResultSummary) addError(err string) {
-	r.Errors = append(r.Errors, err)
-}
-
 // Converter includes general mesh wide settings.
 type Converter struct {
 	RootNamespace string
 	Service       *ServiceStore
+	// MeshConfig is the mesh wide authentication settings in the MeshConfig, nil if not found.
+	MeshConfig *MeshConfig
+
+	// principalBindings records the principal binding of the converted authentication policies, it is used to
+	// convert the RBAC policies that depend on the principal.
+	principalBindings []*principalBinding
 }
 
 // ServiceStore represents all services in the cluster.
 type ServiceStore struct {
 	Services map[string]*corev1.Service
+	// Pods includes the pods selected by the services, it is used to resolve the named target port of the service and
+	// to detect the PeerAuthentications selecting the same pods.
+	Pods []*corev1.Pod
+	// Namespaces includes all namespaces in the mesh, it is needed if only the referenced services are loaded so that
+	// the namespaces without any loaded service are still known.
+	Namespaces []string
 }
 
 // NewConverter constructs a Converter.
@@ -68,11 +74,46 @@ func (ss *ServiceStore) serviceToSelector(name, namespace string) (*commonpb.Wor
 	return nil, fmt.Errorf("could not find service %s", service)
 }
 
+// AddPods adds the pods selected by the services.
+func (ss *ServiceStore) AddPods(pods []corev1.Pod) {
+	for _, pod := range pods {
+		pod := pod
+		ss.Pods = append(ss.Pods, &pod)
+	}
+}
+
+// servicesInNamespace returns the services in the namespace sorted by name, filter is used to select the services.
+func (ss *ServiceStore) servicesInNamespace(namespace string, filter func(name string) bool) []*corev1.Service {
+	var ret []*corev1.Service
+	for _, svc := range ss.Services {
+		if svc.Namespace == namespace && (filter == nil || filter(svc.Name)) {
+			ret = append(ret, svc)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// portError is the error in resolving the service port to the workload port.
+type portError struct {
+	code IssueCode
+	msg  string
+}
+
+func (e *portError) Error() string {
+	return e.msg
+}
+
 func (ss *ServiceStore) svcPortToWorkloadPort(name, namespace string, svcPort *authnpb.PortSelector) (uint32, error) {
 	service := namespace + "." + name
 	if svc, found := ss.Services[service]; found {
 		for _, port := range svc.Spec.Ports {
 			if (svcPort.GetName() != "" && port.Name == svcPort.GetName()) || (svcPort.GetNumber() != 0 && uint32(port.Port) == svcPort.GetNumber()) {
+				if port.TargetPort.Type == intstr.String && port.TargetPort.StrVal != "" {
+					return ss.resolveTargetPort(svc, port.TargetPort.StrVal)
+				}
 				if port.TargetPort.IntVal == 0 {
 					return uint32(port.Port), nil
 				}
@@ -80,7 +121,46 @@ func (ss *ServiceStore) svcPortToWorkloadPort(name, namespace string, svcPort *a
 			}
 		}
 	}
-	return 0, fmt.Errorf("could not find port %v for service %s", svcPort, service)
+	return 0, &portError{code: CodePortNotFound, msg: fmt.Sprintf("could not find port %v for service %s", svcPort, service)}
+}
+
+// resolveTargetPort resolves the named target port of the service to the container port of the selected pods.
+func (ss *ServiceStore) resolveTargetPort(svc *corev1.Service, portName string) (uint32, error) {
+	service := svc.Namespace + "." + svc.Name
+	resolved := map[uint32][]string{}
+	for _, pod := range ss.Pods {
+		if pod.Namespace != svc.Namespace || len(svc.Spec.Selector) == 0 || !labelsSubset(svc.Spec.Selector, pod.Labels) {
+			continue
+		}
+		for _, container := range pod.Spec.Containers {
+			for _, port := range container.Ports {
+				if port.Name == portName {
+					resolved[uint32(port.ContainerPort)] = append(resolved[uint32(port.ContainerPort)], pod.Name)
+				}
+			}
+		}
+	}
+
+	switch len(resolved) {
+	case 0:
+		return 0, &portError{code: CodeTargetPortUnresolved,
+			msg: fmt.Sprintf("could not resolve named target port %s for service %s, no selected pod has the container port", portName, service)}
+	case 1:
+		for port := range resolved {
+			return port, nil
+		}
+	}
+	var ports []uint32
+	for port := range resolved {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	var details []string
+	for _, port := range ports {
+		details = append(details, fmt.Sprintf("%d (pods %s)", port, strings.Join(resolved[port], ", ")))
+	}
+	return 0, &portError{code: CodeTargetPortInconsistent,
+		msg: fmt.Sprintf("named target port %s for service %s is resolved to different ports: %s", portName, service, strings.Join(details, ", "))}
 }
 
 // InputPolicy includes a v1alpha1 authentication policy.
@@ -98,54 +178,164 @@ type outputSelector struct {
 	Port      []uint32
 }
 
+// Annotations and labels of the beta objects generated by the tool.
+const (
+	// ConvertAnnotation describes how the beta object is converted.
+	ConvertAnnotation = "security.istio.io/alpha-policy-convert"
+	// SourceAnnotation references the alpha policy that the beta object is converted from.
+	SourceAnnotation = "security.istio.io/alpha-policy-convert-source"
+	// RunLabel is the ID of the run that generated the beta object.
+	RunLabel = "security.istio.io/alpha-policy-convert-run"
+)
+
 // OutputPolicy includes the v1beta1 policy converted from v1alpha authentication policy.
 type OutputPolicy struct {
 	Name         string
 	Namespace    string
 	Comment      string // Could be added to the annotation, e.g. security.istio.io/autoConversionResult: "..."
+	Source       ObjectReference
+	Labels       map[string]string
 	PeerAuthN    *betapb.PeerAuthentication
 	RequestAuthN *betapb.RequestAuthentication
 	Authz        *betapb.AuthorizationPolicy
+	// EnvoyFilter is only generated with PreserveUnauthorized to return 401 for the request without JWT.
+	EnvoyFilter *networkingpb.EnvoyFilter
+	// DryRun generates the AuthorizationPolicy with the dry-run annotation, see ShadowJWTRequirements.
+	DryRun bool
+	// APIVersion is the version of the security.istio.io objects, empty means v1beta1, see UseAPIVersion.
+	APIVersion string
+	// TargetRefs attaches a copy of the RequestAuthentication and AuthorizationPolicy to the waypoint in v1.
+	TargetRefs []TargetRef
 }
 
-// ToYAML converts output to yaml.
-func (output *OutputPolicy) ToYAML() string {
-	obj := &ObjectStruct{}
-	obj.SetName(output.Name)
-	obj.SetNamespace(output.Namespace)
-	if output.Comment != "" {
-		obj.SetAnnotations(map[string]string{"security.istio.io/alpha-policy-convert": output.Comment})
+// GroupVersionKind of the beta policies.
+var (
+	PeerAuthenticationGVK    = schema.GroupVersionKind{Group: "security.istio.io", Version: "v1beta1", Kind: "PeerAuthentication"}
+	RequestAuthenticationGVK = schema.GroupVersionKind{Group: "security.istio.io", Version: "v1beta1", Kind: "RequestAuthentication"}
+	AuthorizationPolicyGVK   = schema.GroupVersionKind{Group: "security.istio.io", Version: "v1beta1", Kind: "AuthorizationPolicy"}
+	EnvoyFilterGVK           = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1alpha3", Kind: "EnvoyFilter"}
+)
+
+// ObjectReference identifies a beta object generated in the conversion.
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+}
+
+// String returns the reference in the format of kind/namespace/name, or kind/name for cluster scoped object.
+func (ref ObjectReference) String() string {
+	if ref.Namespace == "" {
+		return ref.Kind + "/" + ref.Name
 	}
+	return ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+}
 
-	var data strings.Builder
+// References returns the references of the beta objects included in the output.
+func (output *OutputPolicy) References() []ObjectReference {
+	var ret []ObjectReference
+	add := func(gvk schema.GroupVersionKind) {
+		apiVersion, kind := OutputGVK(gvk, output.APIVersion).ToAPIVersionAndKind()
+		ret = append(ret, ObjectReference{APIVersion: apiVersion, Kind: kind, Namespace: output.Namespace, Name: output.Name})
+		if len(output.TargetRefs) != 0 && (gvk == RequestAuthenticationGVK || gvk == AuthorizationPolicyGVK) {
+			ret = append(ret, ObjectReference{APIVersion: apiVersion, Kind: kind, Namespace: output.Namespace,
+				Name: output.Name + WaypointSuffix})
+		}
+	}
 	if output.PeerAuthN != nil {
-		obj.SetGroupVersionKind(schema.GroupVersionKind{Group: "security.istio.io", Version: "v1beta1", Kind: "PeerAuthentication"})
-		data.WriteString(specToYAML(obj, output.PeerAuthN))
-		data.WriteString("\n---\n")
+		add(PeerAuthenticationGVK)
 	}
 	if output.RequestAuthN != nil {
-		obj.SetGroupVersionKind(schema.GroupVersionKind{Group: "security.istio.io", Version: "v1beta1", Kind: "RequestAuthentication"})
-		data.WriteString(specToYAML(obj, output.RequestAuthN))
-		data.WriteString("\n---\n")
+		add(RequestAuthenticationGVK)
+	}
+	if output.Authz != nil {
+		add(AuthorizationPolicyGVK)
+	}
+	if output.EnvoyFilter != nil {
+		add(EnvoyFilterGVK)
+	}
+	return ret
+}
+
+// ToObjects converts output to the beta objects.
+func (output *OutputPolicy) ToObjects() []*ObjectStruct {
+	var ret []*ObjectStruct
+	newObject := func(name string, gvk schema.GroupVersionKind, spec proto.Message) *ObjectStruct {
+		obj := &ObjectStruct{}
+		obj.SetGroupVersionKind(OutputGVK(gvk, output.APIVersion))
+		obj.SetName(name)
+		obj.SetNamespace(output.Namespace)
+		annotations := map[string]string{}
+		if output.Comment != "" {
+			annotations[ConvertAnnotation] = output.Comment
+		}
+		if output.Source.Kind != "" {
+			annotations[SourceAnnotation] = output.Source.String()
+		}
+		// Only the AuthorizationPolicy is in dry-run mode, the other objects from the same output are enforced.
+		if output.DryRun && gvk == AuthorizationPolicyGVK {
+			annotations[DryRunAnnotation] = "true"
+			annotations[ConvertAnnotation] = output.Comment + DryRunComment
+		}
+		if len(annotations) != 0 {
+			obj.SetAnnotations(annotations)
+		}
+		if len(output.Labels) != 0 {
+			obj.SetLabels(output.Labels)
+		}
+		obj.Spec = specToMap(spec)
+		return obj
+	}
+	add := func(gvk schema.GroupVersionKind, spec proto.Message) {
+		ret = append(ret, newObject(output.Name, gvk, spec))
+		if len(output.TargetRefs) != 0 && (gvk == RequestAuthenticationGVK || gvk == AuthorizationPolicyGVK) {
+			// Keep the policy with selector for the traffic bypassing the waypoint and attach a copy to the waypoint.
+			waypoint := newObject(output.Name+WaypointSuffix, gvk, spec)
+			delete(waypoint.Spec, "selector")
+			waypoint.Spec["targetRefs"] = targetRefsToList(output.TargetRefs)
+			ret = append(ret, waypoint)
+		}
+	}
+	if output.PeerAuthN != nil {
+		add(PeerAuthenticationGVK, output.PeerAuthN)
+	}
+	if output.RequestAuthN != nil {
+		add(RequestAuthenticationGVK, output.RequestAuthN)
 	}
 	if output.Authz != nil {
-		obj.SetGroupVersionKind(schema.GroupVersionKind{Group: "security.istio.io", Version: "v1beta1", Kind: "AuthorizationPolicy"})
-		data.WriteString(specToYAML(obj, output.Authz))
+		add(AuthorizationPolicyGVK, output.Authz)
+	}
+	if output.EnvoyFilter != nil {
+		add(EnvoyFilterGVK, output.EnvoyFilter)
+	}
+	return ret
+}
+
+// ToYAML converts output to yaml.
+func (output *OutputPolicy) ToYAML() string {
+	var data strings.Builder
+	for _, obj := range output.ToObjects() {
+		data.WriteString(objectToYAML(obj))
 		data.WriteString("\n---\n")
 	}
 	return data.String()
 }
 
-func specToYAML(obj *ObjectStruct, spec proto.Message) string {
+func specToMap(spec proto.Message) map[string]interface{} {
 	m := jsonpb.Marshaler{}
 	jsonStr, err := m.MarshalToString(spec)
 	if err != nil {
 		log.Fatalf("failed to marshal to string: %v", err)
 	}
-	obj.Spec = map[string]interface{}{}
-	if err := json.Unmarshal([]byte(jsonStr), &obj.Spec); err != nil {
+	ret := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(jsonStr), &ret); err != nil {
 		log.Fatalf("failed to unmarshal to object: %v", err)
 	}
+	return ret
+}
+
+func objectToYAML(obj *ObjectStruct) string {
 	jsonOut, err := json.Marshal(obj)
 	if err != nil {
 		log.Fatalf("failed to marshal policy: %v", err)
@@ -166,15 +356,13 @@ func (mc *Converter) Convert(input *InputPolicy) ([]*OutputPolicy, *ResultSummar
 	var outputSelectors []*outputSelector
 	foundTarget := map[string]struct{}{}
 	if len(input.Policy.Targets) != 0 {
-		for _, target := range input.Policy.Targets {
+		for i, target := range input.Policy.Targets {
 			if _, found := foundTarget[target.Name]; found {
-				result.addError(fmt.Sprintf("found duplicate target %s", target.Name))
+				result.addError(CodeDuplicateTarget, fmt.Sprintf("spec.targets[%d].name", i), fmt.Sprintf("found duplicate target %s", target.Name))
 			} else {
 				foundTarget[target.Name] = struct{}{}
 			}
-			if selector, err := mc.targetToSelector(input, target); err != nil {
-				result.addError(fmt.Sprintf("failed to convert target (%s) to workload selector: %v", target.Name, err))
-			} else {
+			if selector := mc.targetToSelector(input, i, target, result); selector != nil {
 				outputSelectors = append(outputSelectors, selector)
 			}
 		}
@@ -198,16 +386,32 @@ func (mc *Converter) Convert(input *InputPolicy) ([]*OutputPolicy, *ResultSummar
 		}
 	}
 
+	mc.recordPrincipalBinding(input, outputSelectors)
 	outputPolicies := convertMTLS(outputSelectors, input, result)
 	outputPolicies = append(outputPolicies, convertJWT(outputSelectors, input, result)...)
+	kind := "Policy"
+	if input.Namespace == "" {
+		kind = "MeshPolicy"
+	}
+	setSource(outputPolicies, "authentication.istio.io/v1alpha1", kind, input.Namespace, input.Name)
 
 	return outputPolicies, result
 }
 
-func (mc *Converter) targetToSelector(input *InputPolicy, target *authnpb.TargetSelector) (*outputSelector, error) {
+func setSource(outputs []*OutputPolicy, apiVersion, kind, namespace, name string) {
+	for _, output := range outputs {
+		output.Source = ObjectReference{APIVersion: apiVersion, Kind: kind, Namespace: namespace, Name: name}
+	}
+}
+
+func (mc *Converter) targetToSelector(input *InputPolicy, index int, target *authnpb.TargetSelector, result *ResultSummary) *outputSelector {
+	addError := func(code IssueCode, field string, err error) {
+		result.addError(code, field, fmt.Sprintf("failed to convert target (%s) to workload selector: %v", target.Name, err))
+	}
 	selector, err := mc.Service.serviceToSelector(target.Name, input.Namespace)
 	if err != nil {
-		return nil, err
+		addError(CodeServiceNotFound, fmt.Sprintf("spec.targets[%d].name", index), err)
+		return nil
 	}
 
 	output := &outputSelector{
@@ -217,15 +421,20 @@ func (mc *Converter) targetToSelector(input *InputPolicy, target *authnpb.Target
 		Selector:  selector,
 	}
 
-	for _, port := range target.Ports {
+	for i, port := range target.Ports {
 		workloadPort, err := mc.Service.svcPortToWorkloadPort(target.Name, input.Namespace, port)
 		if err != nil {
-			return nil, err
+			code := CodePortNotFound
+			if portErr, ok := err.(*portError); ok {
+				code = portErr.code
+			}
+			addError(code, fmt.Sprintf("spec.targets[%d].ports[%d]", index, i), err)
+			return nil
 		}
 		output.Port = append(output.Port, workloadPort)
 	}
 
-	return output, nil
+	return output
 }
 
 func convertMTLS(selectors []*outputSelector, input *InputPolicy, result *ResultSummary) []*OutputPolicy {
@@ -275,7 +484,7 @@ func convertJWT(selectors []*outputSelector, input *InputPolicy, result *ResultS
 		requestAuthn := &betapb.RequestAuthentication{
 			Selector: selector.Selector,
 		}
-		for _, origin := range input.Policy.Origins {
+		for i, origin := range input.Policy.Origins {
 			if origin.Jwt == nil {
 				continue
 			}
@@ -295,18 +504,23 @@ func convertJWT(selectors []*outputSelector, input *InputPolicy, result *ResultS
 
 			// Check some unsupported cases.
 			if len(jwt.TriggerRules) > 0 {
-				if len(input.Policy.Origins) > 1 {
-					result.addError("triggerRule is not supported with multiple JWT issuer by the tool, please convert manually")
-				}
-				for _, rule := range jwt.TriggerRules {
-					for _, path := range rule.IncludedPaths {
-						if path.GetRegex() != "" {
-							result.addError(fmt.Sprintf("triggerRule.regex (%q) is not supported in beta policy", path.GetRegex()))
+				for j, rule := range jwt.TriggerRules {
+					for k, path := range rule.IncludedPaths {
+						if path.GetRegex() == "" {
+							continue
+						}
+						if _, err := regexPaths(path.GetRegex()); err != nil {
+							result.addError(CodeTriggerRegexUnsupported, fmt.Sprintf("spec.origins[%d].jwt.triggerRules[%d].includedPaths[%d].regex", i, j, k),
+								fmt.Sprintf("triggerRule.regex (%q) is not supported in beta policy: %v", path.GetRegex(), err))
 						}
 					}
-					for _, path := range rule.ExcludedPaths {
-						if path.GetRegex() != "" {
-							result.addError(fmt.Sprintf("triggerRule.regex (%q) is not supported in beta policy", path.GetRegex()))
+					for k, path := range rule.ExcludedPaths {
+						if path.GetRegex() == "" {
+							continue
+						}
+						if _, err := regexPaths(path.GetRegex()); err != nil {
+							result.addError(CodeTriggerRegexUnsupported, fmt.Sprintf("spec.origins[%d].jwt.triggerRules[%d].excludedPaths[%d].regex", i, j, k),
+								fmt.Sprintf("triggerRule.regex (%q) is not supported in beta policy: %v", path.GetRegex(), err))
 						}
 					}
 				}
@@ -346,29 +560,20 @@ func convertJWT(selectors []*outputSelector, input *InputPolicy, result *ResultS
 			if len(input.Policy.Origins) == 1 && len(input.Policy.Origins[0].GetJwt().GetTriggerRules()) > 0 {
 				// Support the trigger rule if there is only 1 JWT issuer.
 				for _, trigger := range input.Policy.Origins[0].GetJwt().GetTriggerRules() {
-					extractPaths := func(pathMatchers []*authnpb.StringMatch) []string {
-						if len(pathMatchers) == 0 {
-							return nil
-						}
-						var ret []string
-						for _, path := range pathMatchers {
-							if path.GetExact() != "" {
-								ret = append(ret, path.GetExact())
-							} else if path.GetPrefix() != "" {
-								ret = append(ret, path.GetPrefix()+"*")
-							} else if path.GetSuffix() != "" {
-								ret = append(ret, "*"+path.GetSuffix())
-							} else {
-								return nil
-							}
-						}
-						return ret
-					}
-					includePaths := extractPaths(trigger.IncludedPaths)
-					excludePaths := extractPaths(trigger.ExcludedPaths)
+					includePaths := triggerPaths(trigger.IncludedPaths)
+					excludePaths := triggerPaths(trigger.ExcludedPaths)
 					// Each trigger rule is translated to a separate authz rule.
 					authzPolicy.Rules = append(authzPolicy.Rules, newRule(includePaths, excludePaths))
 				}
+			} else if len(input.Policy.Origins) > 1 && hasTriggerRules(input.Policy.Origins) {
+				// Enforce the trigger rules of each JWT issuer independently with the iss claim.
+				rules, err := convertTriggerRules(input.Policy.Origins, selector.Port)
+				if err != nil {
+					result.addError(CodeTriggerMultipleIssuers, "spec.origins",
+						fmt.Sprintf("triggerRule with multiple JWT issuers could not be converted (%v), please convert manually", err))
+					rules = []*betapb.Rule{newRule(nil, nil)}
+				}
+				authzPolicy.Rules = rules
 			} else {
 				// Only need a single authz rule if there is no trigger rule defined.
 				authzPolicy.Rules = []*betapb.Rule{newRule(nil, nil)}
@@ -391,23 +596,47 @@ func extractMTLS(input *InputPolicy, result *ResultSummary) mTLSMode {
 		return Unset
 	}
 
-	peerMethod := input.Policy.Peers[0]
-	if peerMethod.GetJwt() != nil {
-		result.addError(fmt.Sprintf("JWT is never supported in peer method"))
-	} else if peerMethod.GetMtls() != nil {
-		switch peerMethod.GetMtls().Mode {
-		case authnpb.MutualTls_PERMISSIVE:
-			return Permissive
-		case authnpb.MutualTls_STRICT:
-			return Strict
-		default:
-			result.addError(fmt.Sprintf("found unsupported mTLS mode %s", peerMethod.GetMtls().Mode))
+	// The first mTLS peer method is used in alpha, the other mTLS peer methods are ignored.
+	var mtls *authnpb.MutualTls
+	mtlsField := ""
+	for i, peerMethod := range input.Policy.Peers {
+		field := fmt.Sprintf("spec.peers[%d]", i)
+		if peerMethod.GetJwt() != nil {
+			result.addError(CodeJWTPeerUnsupported, field+".jwt", "JWT is never supported in peer method")
+		} else if peerMethod.GetMtls() != nil {
+			if mtls == nil {
+				mtls, mtlsField = peerMethod.GetMtls(), field+".mtls"
+			} else if !proto.Equal(mtls, peerMethod.GetMtls()) {
+				result.addWarning(CodePeerMethodIgnored, field,
+					fmt.Sprintf("peers[%d] is ignored, only the first mTLS peer method (mode %s) is used", i, mtls.Mode))
+			}
+		} else {
+			result.addError(CodePeerMethodEmpty, field, "Neither mTLS nor JWT peer method specified")
 		}
-	} else {
-		result.addError(fmt.Sprintf("Neither mTLS nor JWT peer method specified"))
+	}
+	if mtls == nil {
+		return Unset
 	}
 
-	return Unset
+	if mtls.AllowTls {
+		result.addError(CodeAllowTLSUnsupported, mtlsField+".allowTls",
+			"allowTls is not supported in beta policy, TLS without client certificate will be rejected")
+	}
+	mode := Unset
+	switch mtls.Mode {
+	case authnpb.MutualTls_PERMISSIVE:
+		mode = Permissive
+	case authnpb.MutualTls_STRICT:
+		mode = Strict
+	default:
+		result.addError(CodeMTLSModeUnsupported, mtlsField+".mode", fmt.Sprintf("found unsupported mTLS mode %s", mtls.Mode))
+	}
+	if input.Policy.PeerIsOptional && mode == Strict {
+		result.addWarning(CodePeerIsOptional, "spec.peerIsOptional",
+			"peerIsOptional is converted to PERMISSIVE mode, plaintext traffic is still accepted")
+		mode = Permissive
+	}
+	return mode
 }
 
 func toStr(ports []uint32) []string {
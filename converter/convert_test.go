@@ -169,14 +169,35 @@ func compareOutputPolicy(t *testing.T, got []*OutputPolicy, want []*OutputPolicy
 	}
 }
 
+func testPod(name, namespace string, labels map[string]string, portName string, port int32) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "app",
+					Ports: []corev1.ContainerPort{{Name: portName, ContainerPort: port}},
+				},
+			},
+		},
+	}
+}
+
 func TestConverter_Convert_Fail(t *testing.T) {
 	cases := []struct {
 		wantError   string
+		wantCode    IssueCode
 		svcList     *corev1.ServiceList
+		pods        []corev1.Pod
 		inputPolicy *InputPolicy
 	}{
 		{
 			wantError: "found duplicate target my-service",
+			wantCode:  CodeDuplicateTarget,
 			svcList: &corev1.ServiceList{
 				Items: []corev1.Service{
 					{
@@ -207,6 +228,7 @@ spec:
 		},
 		{
 			wantError: "failed to convert target (my-service) to workload selector: could not find port number:8000",
+			wantCode:  CodePortNotFound,
 			svcList: &corev1.ServiceList{
 				Items: []corev1.Service{
 					{
@@ -244,6 +266,7 @@ spec:
 		},
 		{
 			wantError: "failed to convert target (my-service) to workload selector: could not find port name:\"tcp\"",
+			wantCode:  CodePortNotFound,
 			svcList: &corev1.ServiceList{
 				Items: []corev1.Service{
 					{
@@ -281,6 +304,7 @@ spec:
 		},
 		{
 			wantError: "failed to convert target (my-service-bla) to workload selector: could not find service bar.my-service-bla",
+			wantCode:  CodeServiceNotFound,
 			svcList: &corev1.ServiceList{
 				Items: []corev1.Service{
 					{
@@ -309,7 +333,8 @@ spec:
 `),
 		},
 		{
-			wantError: "triggerRule is not supported with multiple JWT issuer",
+			wantError: "triggerRule with multiple JWT issuers could not be converted",
+			wantCode:  CodeTriggerMultipleIssuers,
 			inputPolicy: inputPolicy(t, `
 apiVersion: authentication.istio.io/v1alpha1
 kind: Policy
@@ -319,19 +344,23 @@ metadata:
 spec:
   origins:
   - jwt:
-      issuer: "testing@secure.istio.io"
+      issuer: "issuer-a@secure.istio.io"
       jwksUri: "https://secure.istio.io"
+      triggerRules:
+      - includedPaths:
+        - prefix: /a/
   - jwt:
-      issuer: "testing@secure.istio.io"
+      issuer: "issuer-b@secure.istio.io"
       jwksUri: "https://secure.istio.io"
       triggerRules:
-      - includedPaths:
-        - exact: /includeExact
+      - excludedPaths:
+        - suffix: .json
   principalBinding: USE_ORIGIN
 `),
 		},
 		{
-			wantError: "triggerRule.regex (\"some-regex\") is not supported",
+			wantError: "triggerRule.regex (\"/api/v[0-9]+/.*\") is not supported in beta policy: the repetition [0-9]+ is not supported",
+			wantCode:  CodeTriggerRegexUnsupported,
 			inputPolicy: inputPolicy(t, `
 apiVersion: authentication.istio.io/v1alpha1
 kind: Policy
@@ -345,12 +374,28 @@ spec:
       jwksUri: "https://secure.istio.io"
       triggerRules:
       - includedPaths:
-        - regex: some-regex
+        - regex: /api/v[0-9]+/.*
   principalBinding: USE_ORIGIN
+`),
+		},
+		{
+			wantError: "allowTls is not supported in beta policy",
+			wantCode:  CodeAllowTLSUnsupported,
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: bar
+spec:
+  peers:
+  - mtls:
+      allowTls: true
 `),
 		},
 		{
 			wantError: "JWT is never supported in peer method",
+			wantCode:  CodeJWTPeerUnsupported,
 			inputPolicy: inputPolicy(t, `
 apiVersion: authentication.istio.io/v1alpha1
 kind: Policy
@@ -362,6 +407,95 @@ spec:
   - jwt:
       issuer: "testing@secure.istio.io"
       jwksUri: "https://secure.istio.io"
+`),
+		},
+		{
+			wantError: "failed to convert target (my-service) to workload selector: could not resolve named target port http-web",
+			wantCode:  CodeTargetPortUnresolved,
+			svcList: &corev1.ServiceList{
+				Items: []corev1.Service{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-service",
+							Namespace: "bar",
+						},
+						Spec: corev1.ServiceSpec{
+							Selector: map[string]string{
+								"app": "my-service",
+							},
+							Ports: []corev1.ServicePort{
+								{
+									Name:       "http",
+									Port:       8000,
+									TargetPort: intstr.FromString("http-web"),
+								},
+							},
+						},
+					},
+				},
+			},
+			pods: []corev1.Pod{
+				testPod("other-service", "bar", map[string]string{"app": "other-service"}, "http-web", 9090),
+			},
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: bar
+spec:
+  targets:
+  - name: my-service
+    ports:
+    - name: http
+  peers:
+  - mtls:
+      mode: STRICT
+`),
+		},
+		{
+			wantError: "failed to convert target (my-service) to workload selector: named target port http-web for service bar.my-service is resolved to different ports: 8080 (pods my-service-1), 9090 (pods my-service-2)",
+			wantCode:  CodeTargetPortInconsistent,
+			svcList: &corev1.ServiceList{
+				Items: []corev1.Service{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-service",
+							Namespace: "bar",
+						},
+						Spec: corev1.ServiceSpec{
+							Selector: map[string]string{
+								"app": "my-service",
+							},
+							Ports: []corev1.ServicePort{
+								{
+									Name:       "http",
+									Port:       8000,
+									TargetPort: intstr.FromString("http-web"),
+								},
+							},
+						},
+					},
+				},
+			},
+			pods: []corev1.Pod{
+				testPod("my-service-1", "bar", map[string]string{"app": "my-service"}, "http-web", 8080),
+				testPod("my-service-2", "bar", map[string]string{"app": "my-service"}, "http-web", 9090),
+			},
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: bar
+spec:
+  targets:
+  - name: my-service
+    ports:
+    - name: http
+  peers:
+  - mtls:
+      mode: STRICT
 `),
 		},
 	}
@@ -369,14 +503,18 @@ spec:
 	for _, tc := range cases {
 		t.Run(tc.wantError, func(t *testing.T) {
 			mc := NewConverter("istio-system", tc.svcList)
+			mc.Service.AddPods(tc.pods)
 			output, result := mc.Convert(tc.inputPolicy)
 			if len(result.Errors) == 0 {
 				t.Errorf("want error %q but got no error: %v", tc.wantError, output)
 			}
 			for _, gotErr := range result.Errors {
-				if !strings.HasPrefix(gotErr, tc.wantError) {
+				if !strings.HasPrefix(gotErr.Message, tc.wantError) {
 					t.Errorf("want error %q but got %q", tc.wantError, gotErr)
 				}
+				if gotErr.Code != tc.wantCode || gotErr.Severity != SeverityError {
+					t.Errorf("want code %s with severity %s but got %s with severity %s", tc.wantCode, SeverityError, gotErr.Code, gotErr.Severity)
+				}
 			}
 		})
 	}
@@ -386,6 +524,7 @@ func TestConverter_Convert_Success(t *testing.T) {
 	cases := []struct {
 		name        string
 		svcList     *corev1.ServiceList
+		pods        []corev1.Pod
 		inputPolicy *InputPolicy
 		wantOutput  []*OutputPolicy
 		wantResult  *ResultSummary
@@ -705,6 +844,142 @@ spec:
 `),
 		},
 
+		{
+			name: "named-target-port",
+			svcList: &corev1.ServiceList{
+				Items: []corev1.Service{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-service",
+							Namespace: "bar",
+						},
+						Spec: corev1.ServiceSpec{
+							Selector: map[string]string{
+								"app": "my-service",
+							},
+							Ports: []corev1.ServicePort{
+								{
+									Name:       "http",
+									Port:       8000,
+									TargetPort: intstr.FromString("http-web"),
+								},
+							},
+						},
+					},
+				},
+			},
+			pods: []corev1.Pod{
+				testPod("my-service-1", "bar", map[string]string{"app": "my-service", "ver": "v1"}, "http-web", 8080),
+				testPod("my-service-2", "bar", map[string]string{"app": "my-service", "ver": "v2"}, "http-web", 8080),
+				testPod("other-service", "bar", map[string]string{"app": "other-service"}, "http-web", 9090),
+				testPod("my-service-3", "foo", map[string]string{"app": "my-service"}, "http-web", 9090),
+			},
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: bar
+spec:
+  targets:
+  - name: my-service
+    ports:
+    - name: http
+  peers:
+  - mtls:
+      mode: STRICT
+`),
+			wantOutput: outputPolicy(t, `
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: httpbin-my-service
+  namespace: bar
+spec:
+  selector:
+    matchLabels:
+      app: my-service
+  portLevelMtls:
+    8080:
+      mode: STRICT
+`),
+		},
+
+		{
+			name: "peer-is-optional",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+spec:
+  peers:
+  - mtls:
+      mode: STRICT
+  peerIsOptional: true
+`),
+			wantOutput: outputPolicy(t, `
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: default
+  namespace: foo
+spec:
+  mtls:
+    mode: PERMISSIVE
+`),
+			wantResult: &ResultSummary{
+				Warnings: []*Issue{
+					{
+						Code:     CodePeerIsOptional,
+						Severity: SeverityWarning,
+						Field:    "spec.peerIsOptional",
+						Message:  "peerIsOptional is converted to PERMISSIVE mode, plaintext traffic is still accepted",
+					},
+				},
+			},
+		},
+
+		{
+			name: "multiple-peers",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+spec:
+  peers:
+  - mtls:
+      mode: STRICT
+  - mtls:
+      mode: STRICT
+  - mtls:
+      mode: PERMISSIVE
+`),
+			wantOutput: outputPolicy(t, `
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: default
+  namespace: foo
+spec:
+  mtls:
+    mode: STRICT
+`),
+			wantResult: &ResultSummary{
+				Warnings: []*Issue{
+					{
+						Code:     CodePeerMethodIgnored,
+						Severity: SeverityWarning,
+						Field:    "spec.peers[2]",
+						Message:  "peers[2] is ignored, only the first mTLS peer method (mode STRICT) is used",
+					},
+				},
+			},
+		},
+
 		{
 			name: "jwt",
 			inputPolicy: inputPolicy(t, `
@@ -1089,6 +1364,201 @@ spec:
 `),
 		},
 
+		{
+			name: "jwt-multiple-issuers-trigger-rules",
+			svcList: &corev1.ServiceList{
+				Items: []corev1.Service{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "my-service",
+							Namespace: "bar",
+						},
+						Spec: corev1.ServiceSpec{
+							Selector: map[string]string{
+								"app": "my-service",
+							},
+							Ports: []corev1.ServicePort{
+								{
+									Port:       8000,
+									TargetPort: intstr.FromInt(80),
+								},
+							},
+						},
+					},
+				},
+			},
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: jwt
+  namespace: bar
+spec:
+  targets:
+  - name: my-service
+    ports:
+    - number: 8000
+  origins:
+  - jwt:
+      issuer: "issuer-1@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+      triggerRules:
+      - includedPaths:
+        - prefix: /one
+  - jwt:
+      issuer: "issuer-2@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+      triggerRules:
+      - excludedPaths:
+        - exact: /public
+  principalBinding: USE_ORIGIN
+`),
+			wantOutput: outputPolicy(t, `
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: jwt-my-service
+  namespace: bar
+spec:
+  selector:
+    matchLabels:
+      app: my-service
+  portLevelMtls:
+    80:
+      mode: PERMISSIVE
+---
+apiVersion: security.istio.io/v1beta1
+kind: RequestAuthentication
+metadata:
+  name: jwt-my-service
+  namespace: bar
+spec:
+  selector:
+    matchLabels:
+      app: my-service
+  jwtRules:
+  - issuer: "issuer-1@secure.istio.io"
+    jwksUri: "https://secure.istio.io"
+    forwardOriginalToken: true
+  - issuer: "issuer-2@secure.istio.io"
+    jwksUri: "https://secure.istio.io"
+    forwardOriginalToken: true
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: jwt-my-service
+  namespace: bar
+spec:
+  selector:
+    matchLabels:
+      app: my-service
+  action: DENY
+  rules:
+  - from:
+    - source:
+        notRequestPrincipals: ["*"]
+    to:
+    - operation:
+        paths: ["/one*"]
+        ports: ["80"]
+    - operation:
+        notPaths: ["/public"]
+        ports: ["80"]
+  - to:
+    - operation:
+        notPaths: ["/public", "/one*"]
+        ports: ["80"]
+    when:
+    - key: request.auth.claims[iss]
+      values: ["issuer-1@secure.istio.io"]
+`),
+		},
+
+		{
+			name: "jwt-multiple-issuers-shared-trigger-rules",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: bar
+spec:
+  origins:
+  - jwt:
+      issuer: "issuer-1@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+      triggerRules:
+      - includedPaths:
+        - prefix: /api
+        excludedPaths:
+        - exact: /api/health
+  - jwt:
+      issuer: "issuer-2@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+      triggerRules:
+      - includedPaths:
+        - prefix: /api/v2
+        - exact: /admin
+`),
+			wantOutput: outputPolicy(t, `
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: default
+  namespace: bar
+spec:
+  mtls:
+    mode: PERMISSIVE
+---
+apiVersion: security.istio.io/v1beta1
+kind: RequestAuthentication
+metadata:
+  name: default
+  namespace: bar
+spec:
+  jwtRules:
+  - issuer: "issuer-1@secure.istio.io"
+    jwksUri: "https://secure.istio.io"
+    forwardOriginalToken: true
+  - issuer: "issuer-2@secure.istio.io"
+    jwksUri: "https://secure.istio.io"
+    forwardOriginalToken: true
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: default
+  namespace: bar
+spec:
+  action: DENY
+  rules:
+  - from:
+    - source:
+        notRequestPrincipals: ["*"]
+    to:
+    - operation:
+        paths: ["/api*"]
+        notPaths: ["/api/health"]
+    - operation:
+        paths: ["/api/v2*", "/admin"]
+  - to:
+    - operation:
+        paths: ["/admin"]
+        notPaths: ["/api*"]
+    when:
+    - key: request.auth.claims[iss]
+      values: ["issuer-1@secure.istio.io"]
+  - to:
+    - operation:
+        paths: ["/api*"]
+        notPaths: ["/api/health", "/api/v2*", "/admin"]
+    when:
+    - key: request.auth.claims[iss]
+      values: ["issuer-2@secure.istio.io"]
+`),
+		},
+
 		{
 			name: "jwt-optional",
 			inputPolicy: inputPolicy(t, `
@@ -1138,11 +1608,80 @@ spec:
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			mc := NewConverter("istio-system", tc.svcList)
+			mc.Service.AddPods(tc.pods)
 			output, result := mc.Convert(tc.inputPolicy)
 			compareOutputPolicy(t, output, tc.wantOutput)
+			if tc.wantResult != nil {
+				if diff := cmp.Diff(tc.wantResult, result); diff != "" {
+					t.Errorf("ResultSummary diff (-want +got):\n%s", diff)
+				}
+			}
 			if t.Failed() {
 				t.Logf("got result: %v", result)
 			}
 		})
 	}
 }
+
+func TestResultSummary_Suppress(t *testing.T) {
+	mc := NewConverter("istio-system", nil)
+	_, result := mc.Convert(inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: bar
+spec:
+  peers:
+  - mtls:
+      mode: STRICT
+      allowTls: true
+  - mtls:
+      mode: PERMISSIVE
+  peerIsOptional: true
+`))
+	if len(result.Errors) != 1 || len(result.Warnings) != 2 {
+		t.Fatalf("want 1 error and 2 warnings but got %v", result)
+	}
+	result.Suppress(map[IssueCode]bool{CodeAllowTLSUnsupported: true, CodePeerIsOptional: true})
+	if len(result.Errors) != 0 {
+		t.Errorf("want no error but got %v", result.Errors)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Code != CodePeerMethodIgnored {
+		t.Errorf("want warning %s but got %v", CodePeerMethodIgnored, result.Warnings)
+	}
+	if len(result.Suppressed) != 2 {
+		t.Errorf("want 2 suppressed issues but got %v", result.Suppressed)
+	}
+}
+
+func TestOutputPolicy_ToObjects(t *testing.T) {
+	output := &OutputPolicy{
+		Name:      "httpbin",
+		Namespace: "foo",
+		Comment:   "converted from alpha authentication policy foo/httpbin, service httpbin",
+		Source:    ObjectReference{APIVersion: "authentication.istio.io/v1alpha1", Kind: "Policy", Namespace: "foo", Name: "httpbin"},
+		Labels:    map[string]string{RunLabel: "20200101-000000"},
+		PeerAuthN: &betapb.PeerAuthentication{},
+		Authz:     &betapb.AuthorizationPolicy{},
+	}
+	got := output.ToObjects()
+	if len(got) != 2 {
+		t.Fatalf("want 2 objects but got %d", len(got))
+	}
+	wantKinds := []string{"PeerAuthentication", "AuthorizationPolicy"}
+	for i, obj := range got {
+		if obj.Kind != wantKinds[i] || obj.Namespace != "foo" || obj.Name != "httpbin" {
+			t.Errorf("want %s foo/httpbin but got %s %s/%s", wantKinds[i], obj.Kind, obj.Namespace, obj.Name)
+		}
+		if want := "Policy/foo/httpbin"; obj.Annotations[SourceAnnotation] != want {
+			t.Errorf("want source annotation %q but got %q", want, obj.Annotations[SourceAnnotation])
+		}
+		if want := output.Comment; obj.Annotations[ConvertAnnotation] != want {
+			t.Errorf("want convert annotation %q but got %q", want, obj.Annotations[ConvertAnnotation])
+		}
+		if diff := cmp.Diff(output.Labels, obj.Labels); diff != "" {
+			t.Errorf("labels diff (-want +got):\n%s", diff)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	authnpb "istio.io/api/authentication/v1alpha1"
+	networkingpb "istio.io/api/networking/v1alpha3"
+	betapb "istio.io/api/security/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// InputDestinationRule includes a networking DestinationRule.
+type InputDestinationRule struct {
+	Name      string
+	Namespace string
+	Rule      *networkingpb.DestinationRule
+}
+
+// destinationRuleTLS is a client TLS setting in the DestinationRule.
+type destinationRuleTLS struct {
+	field string
+	tls   *networkingpb.TLSSettings
+	// port is the service port, 0 means all ports.
+	port uint32
+	// labels is the labels of the subset, nil means all workloads of the service.
+	labels map[string]string
+}
+
+// CheckDestinationRule checks the client TLS settings in the DestinationRule against the server mTLS mode of the
+// generated PeerAuthentications that apply to the destination workloads. A TLS mode other than ISTIO_MUTUAL to a
+// workload in STRICT mode is reported as a conflict, the requests would be rejected by the server. The DestinationRule
+// that only sets ISTIO_MUTUAL is reported as redundant as the client TLS is configured automatically with auto mTLS,
+// unless auto mTLS is disabled in the MeshConfig.
+func (mc *Converter) CheckDestinationRule(input *InputDestinationRule, outputs []*OutputPolicy) *ResultSummary {
+	result := &ResultSummary{}
+	services := mc.Service.servicesForHost(input.Rule.Host, input.Namespace)
+
+	var settings []*destinationRuleTLS
+	addPolicy := func(prefix string, policy *networkingpb.TrafficPolicy, labels map[string]string) {
+		if policy.GetTls() != nil {
+			settings = append(settings, &destinationRuleTLS{field: prefix + ".tls", tls: policy.Tls, labels: labels})
+		}
+		for i, port := range policy.GetPortLevelSettings() {
+			if port.Tls != nil {
+				settings = append(settings, &destinationRuleTLS{field: fmt.Sprintf("%s.portLevelSettings[%d].tls", prefix, i),
+					tls: port.Tls, port: port.Port.GetNumber(), labels: labels})
+			}
+		}
+	}
+	addPolicy("spec.trafficPolicy", input.Rule.TrafficPolicy, nil)
+	for i, subset := range input.Rule.Subsets {
+		addPolicy(fmt.Sprintf("spec.subsets[%d].trafficPolicy", i), subset.TrafficPolicy, subset.Labels)
+	}
+
+	for _, svc := range services {
+		for _, setting := range settings {
+			if setting.tls.Mode == networkingpb.TLSSettings_ISTIO_MUTUAL {
+				continue
+			}
+			labels := map[string]string{}
+			for k, v := range svc.Spec.Selector {
+				labels[k] = v
+			}
+			for k, v := range setting.labels {
+				labels[k] = v
+			}
+			for _, svcPort := range svc.Spec.Ports {
+				if setting.port != 0 && uint32(svcPort.Port) != setting.port {
+					continue
+				}
+				port, err := mc.Service.svcPortToWorkloadPort(svc.Name, svc.Namespace,
+					&authnpb.PortSelector{Port: &authnpb.PortSelector_Number{Number: uint32(svcPort.Port)}})
+				if err != nil {
+					continue
+				}
+				mode, peerAuthn := mc.effectiveMTLS(outputs, svc.Namespace, labels, port)
+				if mode != betapb.PeerAuthentication_MutualTLS_STRICT {
+					continue
+				}
+				result.addWarning(CodeDestinationRuleConflict, setting.field, fmt.Sprintf("client TLS mode %s for service %s/%s "+
+					"port %d conflicts with the STRICT mTLS mode in PeerAuthentication %s/%s, the requests will be rejected",
+					setting.tls.Mode, svc.Namespace, svc.Name, svcPort.Port, peerAuthn.Namespace, peerAuthn.Name))
+			}
+		}
+	}
+
+	autoMTLSDisabled := mc.MeshConfig != nil && mc.MeshConfig.EnableAutoMtls != nil && !*mc.MeshConfig.EnableAutoMtls
+	if len(services) != 0 && !autoMTLSDisabled && onlyIstioMutual(input.Rule) {
+		result.addWarning(CodeDestinationRuleRedundant, "spec.trafficPolicy.tls", "the DestinationRule only sets the client "+
+			"TLS mode ISTIO_MUTUAL, it could be removed after the migration with auto mTLS enabled")
+	}
+	return result
+}
+
+// onlyIstioMutual returns true if the DestinationRule has no subsets and the traffic policy only sets ISTIO_MUTUAL.
+func onlyIstioMutual(rule *networkingpb.DestinationRule) bool {
+	if len(rule.Subsets) != 0 || rule.TrafficPolicy == nil {
+		return false
+	}
+	policy := proto.Clone(rule.TrafficPolicy).(*networkingpb.TrafficPolicy)
+	found := false
+	isIstioMutual := func(tls *networkingpb.TLSSettings) bool {
+		return proto.Equal(tls, &networkingpb.TLSSettings{Mode: networkingpb.TLSSettings_ISTIO_MUTUAL})
+	}
+	if isIstioMutual(policy.Tls) {
+		policy.Tls, found = nil, true
+	}
+	var ports []*networkingpb.TrafficPolicy_PortTrafficPolicy
+	for _, port := range policy.PortLevelSettings {
+		if isIstioMutual(port.Tls) && proto.Equal(port, &networkingpb.TrafficPolicy_PortTrafficPolicy{Port: port.Port, Tls: port.Tls}) {
+			found = true
+			continue
+		}
+		ports = append(ports, port)
+	}
+	policy.PortLevelSettings = ports
+	return found && proto.Equal(policy, &networkingpb.TrafficPolicy{})
+}
+
+// DestinationRuleNamespaces returns the namespaces of the services matching the host of the DestinationRule sorted by
+// name, the DestinationRule only affects the workloads in these namespaces.
+func (mc *Converter) DestinationRuleNamespaces(input *InputDestinationRule) []string {
+	var ret []string
+	for _, svc := range mc.Service.servicesForHost(input.Rule.Host, input.Namespace) {
+		if len(ret) == 0 || ret[len(ret)-1] != svc.Namespace {
+			ret = append(ret, svc.Namespace)
+		}
+	}
+	return ret
+}
+
+// servicesForHost returns the services matching the host of the DestinationRule in the namespace, the short name is
+// resolved in the namespace of the DestinationRule.
+func (ss *ServiceStore) servicesForHost(host, namespace string) []*corev1.Service {
+	fqdn := hostFQDN(host, namespace)
+	var ret []*corev1.Service
+	for _, svc := range ss.Services {
+		svcFQDN := fmt.Sprintf("%s.%s.svc.cluster.local", svc.Name, svc.Namespace)
+		if svcFQDN == fqdn || (strings.HasPrefix(fqdn, "*") && strings.HasSuffix(svcFQDN, fqdn[1:])) {
+			ret = append(ret, svc)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Namespace+"/"+ret[i].Name < ret[j].Namespace+"/"+ret[j].Name
+	})
+	return ret
+}
+
+// hostFQDN returns the FQDN of the host of the DestinationRule, the short name is resolved in the namespace of the
+// DestinationRule. The wildcard host is returned as is.
+func hostFQDN(host, namespace string) string {
+	if strings.HasPrefix(host, "*") {
+		return host
+	}
+	switch parts := strings.Split(host, "."); {
+	case len(parts) == 1:
+		return fmt.Sprintf("%s.%s.svc.cluster.local", host, namespace)
+	case len(parts) == 2:
+		return host + ".svc.cluster.local"
+	case len(parts) == 3 && parts[2] == "svc":
+		return host + ".cluster.local"
+	default:
+		return host
+	}
+}
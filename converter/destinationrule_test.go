@@ -0,0 +1,175 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+
+	networkingpb "istio.io/api/networking/v1alpha3"
+	betapb "istio.io/api/security/v1beta1"
+	commonpb "istio.io/api/type/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestConverter_CheckDestinationRule(t *testing.T) {
+	mc := NewConverter("istio-system", &corev1.ServiceList{Items: []corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "httpbin", Namespace: "foo"},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": "httpbin"},
+				Ports: []corev1.ServicePort{
+					{Port: 8000, TargetPort: intstr.FromInt(80)},
+					{Port: 9000, TargetPort: intstr.FromInt(90)},
+				},
+			},
+		},
+	}})
+	outputs := []*OutputPolicy{
+		{
+			Name:      "default",
+			Namespace: "istio-system",
+			PeerAuthN: &betapb.PeerAuthentication{
+				Mtls: &betapb.PeerAuthentication_MutualTLS{Mode: betapb.PeerAuthentication_MutualTLS_PERMISSIVE},
+			},
+		},
+		{
+			Name:      "httpbin",
+			Namespace: "foo",
+			PeerAuthN: &betapb.PeerAuthentication{
+				Selector: &commonpb.WorkloadSelector{MatchLabels: map[string]string{"app": "httpbin"}},
+				PortLevelMtls: map[uint32]*betapb.PeerAuthentication_MutualTLS{
+					80: {Mode: betapb.PeerAuthentication_MutualTLS_STRICT},
+				},
+			},
+		},
+	}
+	tls := func(mode networkingpb.TLSSettings_TLSmode) *networkingpb.TLSSettings {
+		return &networkingpb.TLSSettings{Mode: mode}
+	}
+
+	cases := []struct {
+		name      string
+		namespace string
+		rule      *networkingpb.DestinationRule
+		want      []IssueCode
+	}{
+		{
+			name:      "disable-strict-port",
+			namespace: "foo",
+			rule: &networkingpb.DestinationRule{
+				Host:          "httpbin",
+				TrafficPolicy: &networkingpb.TrafficPolicy{Tls: tls(networkingpb.TLSSettings_DISABLE)},
+			},
+			want: []IssueCode{CodeDestinationRuleConflict},
+		},
+		{
+			name:      "disable-permissive-port",
+			namespace: "bar",
+			rule: &networkingpb.DestinationRule{
+				Host: "httpbin.foo.svc.cluster.local",
+				TrafficPolicy: &networkingpb.TrafficPolicy{
+					PortLevelSettings: []*networkingpb.TrafficPolicy_PortTrafficPolicy{
+						{Port: &networkingpb.PortSelector{Number: 9000}, Tls: tls(networkingpb.TLSSettings_DISABLE)},
+					},
+				},
+			},
+		},
+		{
+			name:      "simple-subset",
+			namespace: "foo",
+			rule: &networkingpb.DestinationRule{
+				Host: "httpbin",
+				Subsets: []*networkingpb.Subset{
+					{
+						Name:   "v1",
+						Labels: map[string]string{"version": "v1"},
+						TrafficPolicy: &networkingpb.TrafficPolicy{
+							Tls: tls(networkingpb.TLSSettings_SIMPLE),
+						},
+					},
+				},
+			},
+			want: []IssueCode{CodeDestinationRuleConflict},
+		},
+		{
+			name:      "redundant",
+			namespace: "istio-system",
+			rule: &networkingpb.DestinationRule{
+				Host:          "*.local",
+				TrafficPolicy: &networkingpb.TrafficPolicy{Tls: tls(networkingpb.TLSSettings_ISTIO_MUTUAL)},
+			},
+			want: []IssueCode{CodeDestinationRuleRedundant},
+		},
+		{
+			name:      "not-redundant-with-load-balancer",
+			namespace: "foo",
+			rule: &networkingpb.DestinationRule{
+				Host: "httpbin",
+				TrafficPolicy: &networkingpb.TrafficPolicy{
+					Tls:          tls(networkingpb.TLSSettings_ISTIO_MUTUAL),
+					LoadBalancer: &networkingpb.LoadBalancerSettings{},
+				},
+			},
+		},
+		{
+			name:      "external-host",
+			namespace: "foo",
+			rule: &networkingpb.DestinationRule{
+				Host:          "www.example.com",
+				TrafficPolicy: &networkingpb.TrafficPolicy{Tls: tls(networkingpb.TLSSettings_SIMPLE)},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := &InputDestinationRule{Name: tc.name, Namespace: tc.namespace, Rule: tc.rule}
+			summary := mc.CheckDestinationRule(input, outputs)
+			if len(summary.Errors) != 0 {
+				t.Errorf("want no error but got %v", summary.Errors)
+			}
+			var got []IssueCode
+			for _, issue := range summary.Warnings {
+				got = append(got, issue.Code)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("want warnings %v but got %v", tc.want, summary.Warnings)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("want warnings %v but got %v", tc.want, summary.Warnings)
+				}
+			}
+		})
+	}
+}
+
+func TestConverter_DestinationRuleNamespaces(t *testing.T) {
+	service := func(name, namespace string) corev1.Service {
+		return corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+	mc := NewConverter("istio-system", &corev1.ServiceList{Items: []corev1.Service{
+		service("httpbin", "foo"), service("sleep", "foo"), service("httpbin", "bar"),
+	}})
+	cases := []struct {
+		host      string
+		namespace string
+		want      []string
+	}{
+		{host: "httpbin", namespace: "foo", want: []string{"foo"}},
+		{host: "httpbin.bar.svc.cluster.local", namespace: "istio-system", want: []string{"bar"}},
+		{host: "*.foo.svc.cluster.local", namespace: "istio-system", want: []string{"foo"}},
+		{host: "*.local", namespace: "istio-system", want: []string{"bar", "foo"}},
+		{host: "www.example.com", namespace: "foo"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.host, func(t *testing.T) {
+			input := &InputDestinationRule{Name: "dr", Namespace: tc.namespace, Rule: &networkingpb.DestinationRule{Host: tc.host}}
+			if got := mc.DestinationRuleNamespaces(input); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want namespaces %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// DiffStatus is the status of a generated beta object compared to the beta objects already in the cluster.
+type DiffStatus string
+
+// New, Changed, Identical and Conflicting for the diff status.
+const (
+	// DiffNew means there is no existing object with the same name or conflicting selector.
+	DiffNew DiffStatus = "NEW"
+	// DiffChanged means the existing object with the same name was generated by the tool but has a different spec.
+	DiffChanged DiffStatus = "CHANGED"
+	// DiffIdentical means the existing object with the same name was generated by the tool and has the same spec.
+	DiffIdentical DiffStatus = "IDENTICAL"
+	// DiffConflicting means the generated object collides by name with an existing object that is hand-authored or
+	// converted from a different alpha policy, or overlaps by selector with an existing hand-authored object.
+	DiffConflicting DiffStatus = "CONFLICTING"
+)
+
+// ObjectDiff is the result of comparing a generated beta object to the existing beta objects.
+type ObjectDiff struct {
+	Object ObjectReference `json:"object"`
+	Status DiffStatus      `json:"status"`
+	// Existing is the existing object with the same name or the overlapping selector, nil for new object.
+	Existing *ObjectReference `json:"existing,omitempty"`
+	Reason   string           `json:"reason,omitempty"`
+	// Diff is the difference of the spec (-existing +generated) if the existing object has the same name.
+	Diff string `json:"diff,omitempty"`
+}
+
+// SameName returns true if the existing object has the same name as the generated object.
+func (d *ObjectDiff) SameName() bool {
+	return d.Existing != nil && d.Existing.Name == d.Object.Name
+}
+
+// IsGenerated returns true if the beta object is generated by the tool.
+func IsGenerated(obj *ObjectStruct) bool {
+	return obj.Annotations[ConvertAnnotation] != "" || obj.Annotations[SourceAnnotation] != "" || obj.Labels[RunLabel] != ""
+}
+
+// Diff compares the generated beta objects to the existing beta objects in the cluster. The existing object with the
+// same kind, namespace and name is compared by the spec, the existing hand-authored PeerAuthentication and
+// RequestAuthentication are also checked for overlapping selector as multiple such objects on the same workload have
+// undefined or combined behavior.
+func Diff(generated []*ObjectStruct, existing []*ObjectStruct) []*ObjectDiff {
+	existingByName := map[ObjectReference]*ObjectStruct{}
+	for _, obj := range existing {
+		existingByName[objectStructReference(obj)] = obj
+	}
+
+	var ret []*ObjectDiff
+	for _, obj := range generated {
+		ref := objectStructReference(obj)
+		diff := &ObjectDiff{Object: ref, Status: DiffNew}
+		ret = append(ret, diff)
+		if old, found := existingByName[ref]; found {
+			diff.Existing = &ref
+			specDiff := cmp.Diff(normalizeSpec(old.Spec), normalizeSpec(obj.Spec))
+			switch {
+			case !IsGenerated(old):
+				diff.Status = DiffConflicting
+				diff.Reason = "the existing object is hand-authored"
+				diff.Diff = specDiff
+			case old.Annotations[SourceAnnotation] != "" && obj.Annotations[SourceAnnotation] != "" &&
+				old.Annotations[SourceAnnotation] != obj.Annotations[SourceAnnotation]:
+				diff.Status = DiffConflicting
+				diff.Reason = fmt.Sprintf("the existing object is converted from a different alpha policy %s", old.Annotations[SourceAnnotation])
+				diff.Diff = specDiff
+			case old.Annotations[DryRunAnnotation] != obj.Annotations[DryRunAnnotation]:
+				diff.Status = DiffChanged
+				diff.Reason = "the dry-run mode is changed"
+				diff.Diff = fmt.Sprintf("%s annotation: %q -> %q\n%s", DryRunAnnotation,
+					old.Annotations[DryRunAnnotation], obj.Annotations[DryRunAnnotation], specDiff)
+			case specDiff == "":
+				diff.Status = DiffIdentical
+			default:
+				diff.Status = DiffChanged
+				diff.Diff = specDiff
+			}
+			continue
+		}
+		if obj.Kind != PeerAuthenticationGVK.Kind && obj.Kind != RequestAuthenticationGVK.Kind {
+			continue
+		}
+		for _, old := range sortedObjects(existing) {
+			if old.Kind != obj.Kind || old.Namespace != obj.Namespace || IsGenerated(old) {
+				continue
+			}
+			if selectorsOverlap(specSelector(old.Spec), specSelector(obj.Spec)) {
+				oldRef := objectStructReference(old)
+				diff.Status = DiffConflicting
+				diff.Existing = &oldRef
+				diff.Reason = fmt.Sprintf("the selector overlaps with the hand-authored %s", oldRef)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+func objectStructReference(obj *ObjectStruct) ObjectReference {
+	return ObjectReference{APIVersion: obj.APIVersion, Kind: obj.Kind, Namespace: obj.Namespace, Name: obj.Name}
+}
+
+func sortedObjects(objects []*ObjectStruct) []*ObjectStruct {
+	ret := append([]*ObjectStruct{}, objects...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return objectStructReference(ret[i]).String() < objectStructReference(ret[j]).String()
+	})
+	return ret
+}
+
+// normalizeSpec returns the spec with the JSON types so that the numbers are compared consistently.
+func normalizeSpec(spec map[string]interface{}) interface{} {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return spec
+	}
+	var ret interface{}
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return spec
+	}
+	if reflect.DeepEqual(ret, map[string]interface{}{}) {
+		return nil
+	}
+	return ret
+}
+
+// specSelector returns the matchLabels of the selector in the spec, nil if the spec has no selector.
+func specSelector(spec map[string]interface{}) map[string]string {
+	selector, _ := spec["selector"].(map[string]interface{})
+	matchLabels, _ := selector["matchLabels"].(map[string]interface{})
+	if len(matchLabels) == 0 {
+		return nil
+	}
+	ret := map[string]string{}
+	for k, v := range matchLabels {
+		ret[k] = fmt.Sprintf("%v", v)
+	}
+	return ret
+}
+
+// selectorsOverlap returns true if the two selectors at the same level could select the same workload, the namespace
+// level selector (nil) does not overlap with the workload level selector as the latter takes precedence.
+func selectorsOverlap(a, b map[string]string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == 0 && len(b) == 0
+	}
+	return labelsCompatible(a, b)
+}
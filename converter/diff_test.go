@@ -0,0 +1,226 @@
+package converter
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	generated, err := parseInputs(`
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: new
+  namespace: foo
+  annotations:
+    security.istio.io/alpha-policy-convert-source: Policy/foo/new
+spec:
+  selector:
+    matchLabels:
+      app: new
+  mtls:
+    mode: STRICT
+---
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: identical
+  namespace: foo
+  annotations:
+    security.istio.io/alpha-policy-convert-source: Policy/foo/identical
+spec:
+  portLevelMtls:
+    8080:
+      mode: STRICT
+---
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: changed
+  namespace: bar
+  annotations:
+    security.istio.io/alpha-policy-convert-source: Policy/bar/changed
+spec:
+  mtls:
+    mode: STRICT
+---
+apiVersion: security.istio.io/v1beta1
+kind: RequestAuthentication
+metadata:
+  name: hand-authored
+  namespace: foo
+  annotations:
+    security.istio.io/alpha-policy-convert-source: Policy/foo/hand-authored
+spec:
+  jwtRules:
+  - issuer: foo
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: other-source
+  namespace: foo
+  annotations:
+    security.istio.io/alpha-policy-convert-source: Policy/foo/other-source
+spec:
+  action: DENY
+---
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: overlap
+  namespace: foo
+  annotations:
+    security.istio.io/alpha-policy-convert-source: Policy/foo/overlap
+spec:
+  selector:
+    matchLabels:
+      app: httpbin
+      version: v1
+  mtls:
+    mode: STRICT
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: authz-overlap
+  namespace: foo
+  annotations:
+    security.istio.io/alpha-policy-convert-source: Policy/foo/authz-overlap
+spec:
+  selector:
+    matchLabels:
+      app: httpbin
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: promoted
+  namespace: foo
+  annotations:
+    security.istio.io/alpha-policy-convert-source: Policy/foo/promoted
+spec:
+  action: DENY
+`)
+	if err != nil {
+		t.Fatalf("failed to parse generated objects: %v", err)
+	}
+	existing, err := parseInputs(`
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: identical
+  namespace: foo
+  labels:
+    security.istio.io/alpha-policy-convert-run: 20200101-000000
+  annotations:
+    security.istio.io/alpha-policy-convert-source: Policy/foo/identical
+spec:
+  portLevelMtls:
+    8080:
+      mode: STRICT
+---
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: changed
+  namespace: bar
+  annotations:
+    security.istio.io/alpha-policy-convert-source: Policy/bar/changed
+spec:
+  mtls:
+    mode: PERMISSIVE
+---
+apiVersion: security.istio.io/v1beta1
+kind: RequestAuthentication
+metadata:
+  name: hand-authored
+  namespace: foo
+spec:
+  jwtRules:
+  - issuer: foo
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: other-source
+  namespace: foo
+  annotations:
+    security.istio.io/alpha-policy-convert-source: Policy/foo/another
+spec:
+  action: DENY
+---
+apiVersion: security.istio.io/v1beta1
+kind: PeerAuthentication
+metadata:
+  name: httpbin-strict
+  namespace: foo
+spec:
+  selector:
+    matchLabels:
+      app: httpbin
+  mtls:
+    mode: STRICT
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: httpbin-allow
+  namespace: foo
+spec:
+  selector:
+    matchLabels:
+      app: httpbin
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: promoted
+  namespace: foo
+  annotations:
+    istio.io/dry-run: "true"
+    security.istio.io/alpha-policy-convert-source: Policy/foo/promoted
+spec:
+  action: DENY
+`)
+	if err != nil {
+		t.Fatalf("failed to parse existing objects: %v", err)
+	}
+
+	want := map[string]struct {
+		status   DiffStatus
+		existing string
+	}{
+		"new":           {status: DiffNew},
+		"identical":     {status: DiffIdentical, existing: "identical"},
+		"changed":       {status: DiffChanged, existing: "changed"},
+		"hand-authored": {status: DiffConflicting, existing: "hand-authored"},
+		"other-source":  {status: DiffConflicting, existing: "other-source"},
+		"overlap":       {status: DiffConflicting, existing: "httpbin-strict"},
+		"authz-overlap": {status: DiffNew},
+		"promoted":      {status: DiffChanged, existing: "promoted"},
+	}
+	got := Diff(generated, existing)
+	if len(got) != len(want) {
+		t.Fatalf("want %d diffs but got %d", len(want), len(got))
+	}
+	for _, diff := range got {
+		w, found := want[diff.Object.Name]
+		if !found {
+			t.Errorf("got unexpected diff for %s", diff.Object)
+			continue
+		}
+		if diff.Status != w.status {
+			t.Errorf("%s: want status %s but got %s (%s)", diff.Object, w.status, diff.Status, diff.Reason)
+		}
+		gotExisting := ""
+		if diff.Existing != nil {
+			gotExisting = diff.Existing.Name
+		}
+		if gotExisting != w.existing {
+			t.Errorf("%s: want existing %q but got %q", diff.Object, w.existing, gotExisting)
+		}
+		if (diff.Status == DiffChanged) != (diff.Diff != "" && diff.Status != DiffConflicting) {
+			t.Errorf("%s: want spec diff only for changed object but got %q", diff.Object, diff.Diff)
+		}
+	}
+}
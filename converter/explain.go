@@ -0,0 +1,205 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	betapb "istio.io/api/security/v1beta1"
+)
+
+// ExplainWorkload identifies the workload to explain, either a pod or a service.
+type ExplainWorkload struct {
+	// Kind is either "Pod" or "Service".
+	Kind      string
+	Namespace string
+	Name      string
+	// Labels is the labels of the pod or the selector of the service.
+	Labels map[string]string
+}
+
+// ExplainAlpha is an alpha authentication policy that governs the workload.
+type ExplainAlpha struct {
+	// Service is the service through which the policy governs the workload, empty for the pod not selected by any
+	// service.
+	Service string          `json:"service,omitempty"`
+	Policy  ObjectReference `json:"policy"`
+	// Level is one of "service", "namespace" and "mesh".
+	Level string `json:"level"`
+	// Ports is the workload ports governed by the service level policy, empty means all ports.
+	Ports []uint32 `json:"ports,omitempty"`
+}
+
+// Explanation describes the alpha authentication policies and the generated beta policies that apply to a workload
+// together with the resulting effective authentication.
+type Explanation struct {
+	Workload string            `json:"workload"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Services []string          `json:"services,omitempty"`
+	Alpha    []*ExplainAlpha   `json:"alpha,omitempty"`
+	Beta     []ObjectReference `json:"beta,omitempty"`
+	// MTLS is the effective mTLS mode of the ports not listed in PortMTLS.
+	MTLS     string            `json:"mtls"`
+	PortMTLS map[uint32]string `json:"portMtls,omitempty"`
+	// JWTIssuers includes the issuers of the JWT validated on the workload.
+	JWTIssuers []string `json:"jwtIssuers,omitempty"`
+	// RequiredJWT describes the requests that are denied without a valid JWT.
+	RequiredJWT []string `json:"requiredJwt,omitempty"`
+}
+
+// Explain returns the alpha authentication policies that govern the workload, the beta policies generated from all
+// alpha policies that apply to the workload, and the effective mTLS mode, JWT issuers and required JWT in beta.
+func (mc *Converter) Explain(workload *ExplainWorkload, inputs []*InputPolicy, outputs []*OutputPolicy) *Explanation {
+	ret := &Explanation{
+		Workload: fmt.Sprintf("%s %s/%s", strings.ToLower(workload.Kind), workload.Namespace, workload.Name),
+		Labels:   workload.Labels,
+	}
+	if workload.Kind == "Service" {
+		ret.Services = []string{workload.Name}
+	} else {
+		for _, svc := range mc.Service.servicesInNamespace(workload.Namespace, nil) {
+			if len(svc.Spec.Selector) != 0 && labelsSubset(svc.Spec.Selector, workload.Labels) {
+				ret.Services = append(ret.Services, svc.Name)
+			}
+		}
+	}
+	if len(ret.Services) == 0 {
+		ret.Alpha = alphaFallback(workload.Namespace, "", inputs)
+	}
+	for _, svc := range ret.Services {
+		ret.Alpha = append(ret.Alpha, mc.alphaFor(workload.Namespace, svc, inputs)...)
+	}
+
+	target := &verifyWorkload{namespace: workload.Namespace, labels: workload.Labels}
+	issuers := map[string]bool{}
+	for _, out := range outputs {
+		for _, ref := range out.References() {
+			switch {
+			case ref.Kind == PeerAuthenticationGVK.Kind && mc.betaApplies(out.Namespace, out.PeerAuthN.Selector, target):
+			case ref.Kind == RequestAuthenticationGVK.Kind && mc.betaApplies(out.Namespace, out.RequestAuthN.Selector, target):
+				for _, rule := range out.RequestAuthN.JwtRules {
+					issuers[rule.Issuer] = true
+				}
+			case ref.Kind == AuthorizationPolicyGVK.Kind && mc.betaApplies(out.Namespace, out.Authz.Selector, target):
+				if out.Authz.Action == betapb.AuthorizationPolicy_DENY {
+					ret.RequiredJWT = append(ret.RequiredJWT, describeRequiredJWT(out)...)
+				}
+			default:
+				continue
+			}
+			ret.Beta = append(ret.Beta, ref)
+		}
+	}
+	for issuer := range issuers {
+		ret.JWTIssuers = append(ret.JWTIssuers, issuer)
+	}
+	sort.Strings(ret.JWTIssuers)
+
+	ret.MTLS = "PERMISSIVE (default)"
+	if mode, out := mc.effectiveMTLS(outputs, workload.Namespace, workload.Labels, 0); out != nil {
+		ret.MTLS = fmt.Sprintf("%s (from PeerAuthentication %s/%s)", mode, out.Namespace, out.Name)
+	}
+	if peerAuthns := mc.peerAuthentications(outputs, target); len(peerAuthns) != 0 && len(peerAuthns[0].PeerAuthN.Selector.GetMatchLabels()) != 0 {
+		for port := range peerAuthns[0].PeerAuthN.PortLevelMtls {
+			if ret.PortMTLS == nil {
+				ret.PortMTLS = map[uint32]string{}
+			}
+			mode, _ := mc.effectiveMTLS(outputs, workload.Namespace, workload.Labels, port)
+			ret.PortMTLS[port] = mode.String()
+		}
+	}
+	return ret
+}
+
+// alphaFor returns the alpha policies that govern the workload through the service, the namespace or mesh level policy
+// is also returned if the service level policy only targets some of the ports.
+func (mc *Converter) alphaFor(namespace, service string, inputs []*InputPolicy) []*ExplainAlpha {
+	var ret []*ExplainAlpha
+	for _, input := range inputs {
+		if input.Namespace != namespace {
+			continue
+		}
+		for _, target := range input.Policy.Targets {
+			if target.Name != service {
+				continue
+			}
+			alpha := &ExplainAlpha{Service: service, Policy: inputReference(input), Level: "service"}
+			for _, port := range target.Ports {
+				if workloadPort, err := mc.Service.svcPortToWorkloadPort(service, namespace, port); err == nil {
+					alpha.Ports = append(alpha.Ports, workloadPort)
+				}
+			}
+			if len(alpha.Ports) == 0 {
+				return []*ExplainAlpha{alpha}
+			}
+			ret = append(ret, alpha)
+		}
+	}
+	return append(ret, alphaFallback(namespace, service, inputs)...)
+}
+
+// alphaFallback returns the namespace level policy in the namespace, or the mesh level policy if there is none.
+func alphaFallback(namespace, service string, inputs []*InputPolicy) []*ExplainAlpha {
+	var mesh *ExplainAlpha
+	for _, input := range inputs {
+		if len(input.Policy.Targets) != 0 {
+			continue
+		}
+		switch input.Namespace {
+		case namespace:
+			return []*ExplainAlpha{{Service: service, Policy: inputReference(input), Level: "namespace"}}
+		case "":
+			mesh = &ExplainAlpha{Service: service, Policy: inputReference(input), Level: "mesh"}
+		}
+	}
+	if mesh == nil {
+		return nil
+	}
+	return []*ExplainAlpha{mesh}
+}
+
+func inputReference(input *InputPolicy) ObjectReference {
+	kind := "Policy"
+	if input.Namespace == "" {
+		kind = "MeshPolicy"
+	}
+	return ObjectReference{APIVersion: "authentication.istio.io/v1alpha1", Kind: kind, Namespace: input.Namespace, Name: input.Name}
+}
+
+// describeRequiredJWT describes the rules of the DENY AuthorizationPolicy that deny requests without a valid JWT.
+func describeRequiredJWT(out *OutputPolicy) []string {
+	var ret []string
+	for _, rule := range out.Authz.Rules {
+		var principals []string
+		for _, from := range rule.From {
+			principals = append(principals, from.Source.GetNotRequestPrincipals()...)
+		}
+		if len(principals) == 0 {
+			continue
+		}
+		desc := "all requests"
+		var ops []string
+		for _, to := range rule.To {
+			op := to.Operation
+			var parts []string
+			add := func(name string, values []string) {
+				if len(values) != 0 {
+					parts = append(parts, fmt.Sprintf("%s [%s]", name, strings.Join(values, ", ")))
+				}
+			}
+			add("paths", op.GetPaths())
+			add("not paths", op.GetNotPaths())
+			add("ports", op.GetPorts())
+			add("not ports", op.GetNotPorts())
+			if len(parts) != 0 {
+				ops = append(ops, strings.Join(parts, " "))
+			}
+		}
+		if len(ops) != 0 {
+			desc = strings.Join(ops, " or ")
+		}
+		ret = append(ret, fmt.Sprintf("%s require JWT with request principal [%s] (AuthorizationPolicy %s/%s)",
+			desc, strings.Join(principals, ", "), out.Namespace, out.Name))
+	}
+	return ret
+}
@@ -0,0 +1,88 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestConverter_Explain(t *testing.T) {
+	mc := NewConverter("istio-system", &corev1.ServiceList{Items: []corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "httpbin", Namespace: "foo"},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": "httpbin"},
+				Ports:    []corev1.ServicePort{{Port: 8000, TargetPort: intstr.FromInt(80)}},
+			},
+		},
+	}})
+
+	var inputs []*InputPolicy
+	var outputs []*OutputPolicy
+	for _, input := range []string{`
+apiVersion: authentication.istio.io/v1alpha1
+kind: MeshPolicy
+metadata:
+  name: default
+spec:
+  peers:
+  - mtls: {}
+`, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: foo
+spec:
+  targets:
+  - name: httpbin
+    ports:
+    - number: 8000
+  origins:
+  - jwt:
+      issuer: iss
+      triggerRules:
+      - excludedPaths:
+        - exact: /health
+`} {
+		policy := inputPolicy(t, input)
+		output, summary := mc.Convert(policy)
+		if len(summary.Errors) != 0 {
+			t.Fatalf("failed to convert %s: %v", input, summary.Errors)
+		}
+		inputs = append(inputs, policy)
+		outputs = append(outputs, output...)
+	}
+
+	got := mc.Explain(&ExplainWorkload{Kind: "Pod", Namespace: "foo", Name: "httpbin-1", Labels: map[string]string{"app": "httpbin", "version": "v1"}},
+		inputs, outputs)
+	if got.Workload != "pod foo/httpbin-1" {
+		t.Errorf("want workload pod foo/httpbin-1 but got %s", got.Workload)
+	}
+	if !reflect.DeepEqual(got.Services, []string{"httpbin"}) {
+		t.Errorf("want services [httpbin] but got %v", got.Services)
+	}
+	if len(got.Alpha) != 2 || got.Alpha[0].Level != "service" || !reflect.DeepEqual(got.Alpha[0].Ports, []uint32{80}) ||
+		got.Alpha[1].Level != "mesh" {
+		t.Errorf("want service level policy on port 80 and mesh level policy but got %v", got.Alpha)
+	}
+	if len(got.Beta) != 4 {
+		t.Errorf("want 4 beta policies but got %v", got.Beta)
+	}
+	if got.MTLS != "STRICT (from PeerAuthentication istio-system/default)" {
+		t.Errorf("want mTLS STRICT from mesh but got %s", got.MTLS)
+	}
+	if !reflect.DeepEqual(got.PortMTLS, map[uint32]string{80: "PERMISSIVE"}) {
+		t.Errorf("want port 80 PERMISSIVE but got %v", got.PortMTLS)
+	}
+	if !reflect.DeepEqual(got.JWTIssuers, []string{"iss"}) {
+		t.Errorf("want JWT issuers [iss] but got %v", got.JWTIssuers)
+	}
+	want := []string{"not paths [/health] ports [80] require JWT with request principal [*] (AuthorizationPolicy foo/httpbin-httpbin)"}
+	if !reflect.DeepEqual(got.RequiredJWT, want) {
+		t.Errorf("want required JWT %v but got %v", want, got.RequiredJWT)
+	}
+}
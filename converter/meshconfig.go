@@ -0,0 +1,70 @@
+package converter
+
+import (
+	"fmt"
+
+	betapb "istio.io/api/security/v1beta1"
+)
+
+// Values of the authPolicy in the MeshConfig.
+const (
+	AuthPolicyNone      = "NONE"
+	AuthPolicyMutualTLS = "MUTUAL_TLS"
+)
+
+// MeshConfig includes the mesh wide authentication settings in the istio MeshConfig.
+type MeshConfig struct {
+	// Namespace and Name of the ConfigMap that includes the MeshConfig.
+	Namespace string
+	Name      string
+	// AuthPolicy is either NONE or MUTUAL_TLS, empty if not set.
+	AuthPolicy string
+	// EnableAutoMtls is nil if not set.
+	EnableAutoMtls *bool
+}
+
+// ConvertMeshConfig converts the authPolicy in the MeshConfig to a mesh wide PeerAuthentication in the root namespace
+// if there is no MeshPolicy, meshPolicy is nil if not found. The MeshPolicy takes precedence over the MeshConfig and
+// any disagreement between them is reported.
+func (mc *Converter) ConvertMeshConfig(meshPolicy *InputPolicy) ([]*OutputPolicy, *ResultSummary) {
+	result := &ResultSummary{}
+	config := mc.MeshConfig
+	if config == nil {
+		return nil, result
+	}
+
+	if config.EnableAutoMtls != nil && !*config.EnableAutoMtls {
+		result.addWarning(CodeAutoMTLSDisabled, "data.mesh.enableAutoMtls", "auto mTLS is disabled, the clients only "+
+			"send mTLS to the workloads in STRICT mode with a DestinationRule using ISTIO_MUTUAL")
+	}
+
+	if meshPolicy != nil {
+		mode := extractMTLS(meshPolicy, &ResultSummary{})
+		switch {
+		case config.AuthPolicy == AuthPolicyMutualTLS && mode != Strict:
+			result.addWarning(CodeMeshConfigConflict, "data.mesh.authPolicy", fmt.Sprintf("authPolicy %s disagrees "+
+				"with the MeshPolicy %s that does not require mTLS, the MeshPolicy is used", config.AuthPolicy, meshPolicy.Name))
+		case config.AuthPolicy == AuthPolicyNone && mode == Strict:
+			result.addWarning(CodeMeshConfigConflict, "data.mesh.authPolicy", fmt.Sprintf("authPolicy %s disagrees "+
+				"with the MeshPolicy %s that requires mTLS, the MeshPolicy is used", config.AuthPolicy, meshPolicy.Name))
+		}
+		return nil, result
+	}
+
+	// The NONE authPolicy is the same as the default PERMISSIVE mode in beta, no PeerAuthentication is needed.
+	if config.AuthPolicy != AuthPolicyMutualTLS {
+		return nil, result
+	}
+	output := []*OutputPolicy{
+		{
+			Name:      "default",
+			Namespace: mc.RootNamespace,
+			Comment:   fmt.Sprintf("converted from authPolicy in mesh config %s/%s, mesh level policy", config.Namespace, config.Name),
+			PeerAuthN: &betapb.PeerAuthentication{
+				Mtls: &betapb.PeerAuthentication_MutualTLS{Mode: betapb.PeerAuthentication_MutualTLS_STRICT},
+			},
+		},
+	}
+	setSource(output, "v1", "ConfigMap", config.Namespace, config.Name)
+	return output, result
+}
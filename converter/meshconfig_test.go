@@ -0,0 +1,104 @@
+package converter
+
+import (
+	"testing"
+
+	betapb "istio.io/api/security/v1beta1"
+)
+
+func TestConverter_ConvertMeshConfig(t *testing.T) {
+	strictMeshPolicy := inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: MeshPolicy
+metadata:
+  name: default
+spec:
+  peers:
+  - mtls: {}
+`)
+	permissiveMeshPolicy := inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: MeshPolicy
+metadata:
+  name: default
+spec:
+  peers:
+  - mtls:
+      mode: PERMISSIVE
+`)
+	disabled := false
+
+	cases := []struct {
+		name       string
+		config     *MeshConfig
+		meshPolicy *InputPolicy
+		wantStrict bool
+		want       []IssueCode
+	}{
+		{
+			name:   "no-mesh-config",
+			config: nil,
+		},
+		{
+			name:       "mutual-tls-without-mesh-policy",
+			config:     &MeshConfig{AuthPolicy: AuthPolicyMutualTLS},
+			wantStrict: true,
+		},
+		{
+			name:   "none-without-mesh-policy",
+			config: &MeshConfig{AuthPolicy: AuthPolicyNone},
+		},
+		{
+			name:       "mutual-tls-with-strict-mesh-policy",
+			config:     &MeshConfig{AuthPolicy: AuthPolicyMutualTLS},
+			meshPolicy: strictMeshPolicy,
+		},
+		{
+			name:       "mutual-tls-with-permissive-mesh-policy",
+			config:     &MeshConfig{AuthPolicy: AuthPolicyMutualTLS},
+			meshPolicy: permissiveMeshPolicy,
+			want:       []IssueCode{CodeMeshConfigConflict},
+		},
+		{
+			name:       "none-with-strict-mesh-policy",
+			config:     &MeshConfig{AuthPolicy: AuthPolicyNone},
+			meshPolicy: strictMeshPolicy,
+			want:       []IssueCode{CodeMeshConfigConflict},
+		},
+		{
+			name:       "auto-mtls-disabled",
+			config:     &MeshConfig{AuthPolicy: AuthPolicyMutualTLS, EnableAutoMtls: &disabled},
+			wantStrict: true,
+			want:       []IssueCode{CodeAutoMTLSDisabled},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := NewConverter("istio-config", nil)
+			mc.MeshConfig = tc.config
+			output, summary := mc.ConvertMeshConfig(tc.meshPolicy)
+			if len(summary.Errors) != 0 {
+				t.Errorf("want no error but got %v", summary.Errors)
+			}
+			if len(summary.Warnings) != len(tc.want) {
+				t.Fatalf("want warnings %v but got %v", tc.want, summary.Warnings)
+			}
+			for i, issue := range summary.Warnings {
+				if issue.Code != tc.want[i] {
+					t.Errorf("want warnings %v but got %v", tc.want, summary.Warnings)
+				}
+			}
+			if !tc.wantStrict {
+				if len(output) != 0 {
+					t.Errorf("want no output but got %v", output)
+				}
+				return
+			}
+			if len(output) != 1 || output[0].Namespace != "istio-config" || output[0].PeerAuthN.Selector != nil ||
+				output[0].PeerAuthN.Mtls.GetMode() != betapb.PeerAuthentication_MutualTLS_STRICT {
+				t.Errorf("want mesh wide STRICT PeerAuthentication in istio-config but got %v", output)
+			}
+		})
+	}
+}
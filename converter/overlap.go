@@ -0,0 +1,183 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	betapb "istio.io/api/security/v1beta1"
+)
+
+// podsSelected returns the names of the pods in the namespace selected by the labels, sorted by name.
+func (ss *ServiceStore) podsSelected(namespace string, selector map[string]string) []string {
+	found := map[string]bool{}
+	for _, pod := range ss.Pods {
+		if pod.Namespace == namespace && len(selector) != 0 && labelsSubset(selector, pod.Labels) {
+			found[pod.Name] = true
+		}
+	}
+	var ret []string
+	for name := range found {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// workloadPeerAuthN is a workload level PeerAuthentication in the outputs together with the pods it selects.
+type workloadPeerAuthN struct {
+	output *OutputPolicy
+	pods   []string
+	merged bool
+}
+
+func (w *workloadPeerAuthN) String() string {
+	return fmt.Sprintf("PeerAuthentication %s/%s (from %s)", w.output.Namespace, w.output.Name, w.output.Source)
+}
+
+// sources returns the alpha policies of both PeerAuthentications, only once if they are converted from the same policy.
+func (w *workloadPeerAuthN) sources(other *workloadPeerAuthN) []ObjectReference {
+	if w.output.Source == other.output.Source {
+		return []ObjectReference{w.output.Source}
+	}
+	return []ObjectReference{w.output.Source, other.output.Source}
+}
+
+// overlap returns the pods selected by both PeerAuthentications and whether they select exactly the same pods. The
+// selectors are compared directly if the pods are unknown, in which case only the same selector is considered overlap.
+func (w *workloadPeerAuthN) overlap(other *workloadPeerAuthN) ([]string, bool) {
+	if w.output.Namespace != other.output.Namespace {
+		return nil, false
+	}
+	if len(w.pods) == 0 || len(other.pods) == 0 {
+		if reflect.DeepEqual(w.output.PeerAuthN.Selector.GetMatchLabels(), other.output.PeerAuthN.Selector.GetMatchLabels()) {
+			return []string{"pods with labels " + labelsToString(w.output.PeerAuthN.Selector.GetMatchLabels())}, true
+		}
+		return nil, false
+	}
+	selected := map[string]bool{}
+	for _, pod := range other.pods {
+		selected[pod] = true
+	}
+	var ret []string
+	for _, pod := range w.pods {
+		if selected[pod] {
+			ret = append(ret, pod)
+		}
+	}
+	return ret, len(ret) == len(w.pods) && len(ret) == len(other.pods)
+}
+
+// MergePeerAuthentications checks the workload level PeerAuthentications converted from different service targets
+// that select the same pods, which has undefined behavior in beta as only one of them is applied to the workload. The
+// PeerAuthentications selecting exactly the same pods are merged into a single policy if their mTLS settings are
+// compatible (i.e. no different modes on the same port), PeerAuthentications selecting partially overlapping pods are
+// accepted only if they have the same mTLS settings. The pods are taken from the ServiceStore, PeerAuthentications are
+// only considered overlapping if they use the same selector when the pods are unknown. The issues are attributed to
+// the alpha policies of both PeerAuthentications.
+func (mc *Converter) MergePeerAuthentications(outputs []*OutputPolicy) ([]*OutputPolicy, SourceResults) {
+	results := SourceResults{}
+	var workloads []*workloadPeerAuthN
+	for _, output := range outputs {
+		if output.PeerAuthN == nil || len(output.PeerAuthN.Selector.GetMatchLabels()) == 0 {
+			continue
+		}
+		workloads = append(workloads, &workloadPeerAuthN{
+			output: output,
+			pods:   mc.Service.podsSelected(output.Namespace, output.PeerAuthN.Selector.GetMatchLabels()),
+		})
+	}
+
+	for i, w := range workloads {
+		if w.merged {
+			continue
+		}
+		for _, other := range workloads[i+1:] {
+			if other.merged {
+				continue
+			}
+			pods, samePods := w.overlap(other)
+			if len(pods) == 0 {
+				continue
+			}
+			if samePods {
+				if merged, ok := mergeMTLS(w.output.PeerAuthN, other.output.PeerAuthN); ok {
+					msg := fmt.Sprintf("%s is merged into %s, both select the same pods (%s)", other, w, strings.Join(pods, ", "))
+					for _, source := range w.sources(other) {
+						results.of(source).addWarning(CodePeerAuthenticationMerged, "", msg)
+					}
+					w.output.PeerAuthN = merged
+					w.output.Comment = fmt.Sprintf("%s, merged with %s", w.output.Comment, other.output.Comment)
+					other.merged = true
+					continue
+				}
+			} else if proto.Equal(withoutSelector(w.output.PeerAuthN), withoutSelector(other.output.PeerAuthN)) {
+				// Either policy applied to the overlapping pods has the same result.
+				continue
+			}
+			msg := fmt.Sprintf("%s and %s select the same pods (%s) with different mTLS settings, only one of them will be "+
+				"applied to the pods in beta", w, other, strings.Join(pods, ", "))
+			for _, source := range w.sources(other) {
+				results.of(source).addError(CodePeerAuthenticationConflict, "", msg)
+			}
+		}
+	}
+
+	var ret []*OutputPolicy
+	for _, output := range outputs {
+		merged := false
+		for _, w := range workloads {
+			if w.output == output && w.merged {
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			ret = append(ret, output)
+		} else if output.RequestAuthN != nil || output.Authz != nil {
+			output.PeerAuthN = nil
+			ret = append(ret, output)
+		}
+	}
+	return ret, results
+}
+
+// mergeMTLS merges the mTLS settings of the two PeerAuthentications, it returns false if they have different modes on
+// the same port. The selector of the first PeerAuthentication is used in the merged policy.
+func mergeMTLS(a, b *betapb.PeerAuthentication) (*betapb.PeerAuthentication, bool) {
+	ret := &betapb.PeerAuthentication{Selector: a.Selector}
+	for _, pa := range []*betapb.PeerAuthentication{a, b} {
+		if pa.Mtls == nil {
+			continue
+		}
+		if ret.Mtls != nil && ret.Mtls.Mode != pa.Mtls.Mode {
+			return nil, false
+		}
+		ret.Mtls = &betapb.PeerAuthentication_MutualTLS{Mode: pa.Mtls.Mode}
+	}
+	for _, pa := range []*betapb.PeerAuthentication{a, b} {
+		for port, mtls := range pa.PortLevelMtls {
+			if ret.Mtls != nil {
+				// The port is also covered by the workload level mTLS setting.
+				if mtls.Mode != ret.Mtls.Mode {
+					return nil, false
+				}
+				continue
+			}
+			if old, found := ret.PortLevelMtls[port]; found && old.Mode != mtls.Mode {
+				return nil, false
+			}
+			if ret.PortLevelMtls == nil {
+				ret.PortLevelMtls = map[uint32]*betapb.PeerAuthentication_MutualTLS{}
+			}
+			ret.PortLevelMtls[port] = &betapb.PeerAuthentication_MutualTLS{Mode: mtls.Mode}
+		}
+	}
+	return ret, true
+}
+
+func withoutSelector(pa *betapb.PeerAuthentication) *betapb.PeerAuthentication {
+	return &betapb.PeerAuthentication{Mtls: pa.Mtls, PortLevelMtls: pa.PortLevelMtls}
+}
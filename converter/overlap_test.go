@@ -0,0 +1,162 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	betapb "istio.io/api/security/v1beta1"
+	commonpb "istio.io/api/type/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func testPeerAuthN(name string, selector map[string]string, mode betapb.PeerAuthentication_MutualTLS_Mode, ports ...uint32) *OutputPolicy {
+	pa := &betapb.PeerAuthentication{Selector: &commonpb.WorkloadSelector{MatchLabels: selector}}
+	if len(ports) == 0 {
+		pa.Mtls = &betapb.PeerAuthentication_MutualTLS{Mode: mode}
+	} else {
+		pa.PortLevelMtls = map[uint32]*betapb.PeerAuthentication_MutualTLS{}
+		for _, port := range ports {
+			pa.PortLevelMtls[port] = &betapb.PeerAuthentication_MutualTLS{Mode: mode}
+		}
+	}
+	return &OutputPolicy{Name: name, Namespace: "foo", Comment: name, PeerAuthN: pa,
+		Source: ObjectReference{Kind: "Policy", Namespace: "foo", Name: name}}
+}
+
+func TestConverter_MergePeerAuthentications(t *testing.T) {
+	strict := betapb.PeerAuthentication_MutualTLS_STRICT
+	permissive := betapb.PeerAuthentication_MutualTLS_PERMISSIVE
+	pods := []corev1.Pod{
+		testPod("foo-v1", "foo", map[string]string{"app": "foo", "version": "v1"}, "http", 8080),
+		testPod("foo-v2", "foo", map[string]string{"app": "foo", "version": "v2"}, "http", 8080),
+		testPod("bar", "foo", map[string]string{"app": "bar"}, "http", 8080),
+	}
+	cases := []struct {
+		name       string
+		pods       []corev1.Pod
+		outputs    []*OutputPolicy
+		wantNames  []string
+		wantMerged *betapb.PeerAuthentication
+		wantCode   IssueCode
+	}{
+		{
+			name: "same pods compatible",
+			pods: pods,
+			outputs: []*OutputPolicy{
+				testPeerAuthN("a", map[string]string{"app": "foo"}, strict),
+				testPeerAuthN("b", map[string]string{"app": "foo"}, strict, 8080),
+				testPeerAuthN("c", map[string]string{"app": "bar"}, permissive),
+			},
+			wantNames: []string{"a", "c"},
+			wantMerged: &betapb.PeerAuthentication{
+				Selector: &commonpb.WorkloadSelector{MatchLabels: map[string]string{"app": "foo"}},
+				Mtls:     &betapb.PeerAuthentication_MutualTLS{Mode: strict},
+			},
+			wantCode: CodePeerAuthenticationMerged,
+		},
+		{
+			name: "same pods different ports",
+			pods: pods,
+			outputs: []*OutputPolicy{
+				testPeerAuthN("a", map[string]string{"app": "foo"}, strict, 8080),
+				testPeerAuthN("b", map[string]string{"app": "foo"}, permissive, 9090),
+			},
+			wantNames: []string{"a"},
+			wantMerged: &betapb.PeerAuthentication{
+				Selector: &commonpb.WorkloadSelector{MatchLabels: map[string]string{"app": "foo"}},
+				PortLevelMtls: map[uint32]*betapb.PeerAuthentication_MutualTLS{
+					8080: {Mode: strict},
+					9090: {Mode: permissive},
+				},
+			},
+			wantCode: CodePeerAuthenticationMerged,
+		},
+		{
+			name: "same pods conflict",
+			pods: pods,
+			outputs: []*OutputPolicy{
+				testPeerAuthN("a", map[string]string{"app": "foo"}, strict),
+				testPeerAuthN("b", map[string]string{"app": "foo"}, permissive, 8080),
+			},
+			wantNames: []string{"a", "b"},
+			wantCode:  CodePeerAuthenticationConflict,
+		},
+		{
+			name: "partial overlap same settings",
+			pods: pods,
+			outputs: []*OutputPolicy{
+				testPeerAuthN("a", map[string]string{"app": "foo"}, strict),
+				testPeerAuthN("b", map[string]string{"version": "v1"}, strict),
+			},
+			wantNames: []string{"a", "b"},
+		},
+		{
+			name: "partial overlap conflict",
+			pods: pods,
+			outputs: []*OutputPolicy{
+				testPeerAuthN("a", map[string]string{"app": "foo"}, strict),
+				testPeerAuthN("b", map[string]string{"version": "v1"}, strict, 8080),
+			},
+			wantNames: []string{"a", "b"},
+			wantCode:  CodePeerAuthenticationConflict,
+		},
+		{
+			name: "unknown pods same selector",
+			outputs: []*OutputPolicy{
+				testPeerAuthN("a", map[string]string{"app": "foo"}, strict),
+				testPeerAuthN("b", map[string]string{"app": "foo"}, permissive),
+			},
+			wantNames: []string{"a", "b"},
+			wantCode:  CodePeerAuthenticationConflict,
+		},
+		{
+			name: "unknown pods different selector",
+			outputs: []*OutputPolicy{
+				testPeerAuthN("a", map[string]string{"app": "foo"}, strict),
+				testPeerAuthN("b", map[string]string{"version": "v1"}, permissive),
+			},
+			wantNames: []string{"a", "b"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := NewConverter("istio-system", nil)
+			mc.Service.AddPods(tc.pods)
+			got, results := mc.MergePeerAuthentications(tc.outputs)
+
+			var gotNames []string
+			for _, output := range got {
+				gotNames = append(gotNames, output.Name)
+			}
+			if len(gotNames) != len(tc.wantNames) {
+				t.Fatalf("want outputs %v but got %v", tc.wantNames, gotNames)
+			}
+			for i := range gotNames {
+				if gotNames[i] != tc.wantNames[i] {
+					t.Fatalf("want outputs %v but got %v", tc.wantNames, gotNames)
+				}
+			}
+			if tc.wantMerged != nil && !proto.Equal(got[0].PeerAuthN, tc.wantMerged) {
+				t.Errorf("want merged %v but got %v", tc.wantMerged, got[0].PeerAuthN)
+			}
+
+			if tc.wantCode == "" && len(results) != 0 {
+				t.Errorf("want no issue but got %v", results.Summary())
+			}
+			if tc.wantCode != "" && len(results) != 2 {
+				t.Errorf("want issue %s for both policies but got %v", tc.wantCode, results.Sources())
+			}
+			// The issue is attributed to the alpha policy of each PeerAuthentication.
+			for _, source := range results.Sources() {
+				var gotCodes []IssueCode
+				for _, issue := range append(results[source].Errors, results[source].Warnings...) {
+					gotCodes = append(gotCodes, issue.Code)
+				}
+				if len(gotCodes) != 1 || gotCodes[0] != tc.wantCode {
+					t.Errorf("want issue %s for %s but got %v", tc.wantCode, source, gotCodes)
+				}
+			}
+		})
+	}
+}
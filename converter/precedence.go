@@ -0,0 +1,329 @@
+package converter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	betapb "istio.io/api/security/v1beta1"
+	commonpb "istio.io/api/type/v1beta1"
+)
+
+// policyLevel is the level of the alpha authentication policy that a beta policy is converted from.
+type policyLevel int
+
+const (
+	meshLevel policyLevel = iota
+	namespaceLevel
+	serviceLevel
+)
+
+func outputLevel(output *OutputPolicy) policyLevel {
+	switch {
+	case output.Source.Kind == "MeshPolicy" || output.Source.Kind == "ConfigMap":
+		return meshLevel
+	case len(outputLabels(output)) == 0:
+		return namespaceLevel
+	default:
+		return serviceLevel
+	}
+}
+
+// outputLabels returns the workload selector labels of the beta policies in the output.
+func outputLabels(output *OutputPolicy) map[string]string {
+	switch {
+	case output.PeerAuthN != nil:
+		return output.PeerAuthN.Selector.GetMatchLabels()
+	case output.RequestAuthN != nil:
+		return output.RequestAuthN.Selector.GetMatchLabels()
+	default:
+		return output.Authz.GetSelector().GetMatchLabels()
+	}
+}
+
+// jwtIssuers returns the JWT issuers in the RequestAuthentication of the output.
+func jwtIssuers(output *OutputPolicy) []string {
+	var ret []string
+	for _, rule := range output.RequestAuthN.GetJwtRules() {
+		ret = append(ret, rule.Issuer)
+	}
+	return ret
+}
+
+// serviceTarget is a service (identified by the selector) targeted by a service level alpha policy.
+type serviceTarget struct {
+	labels map[string]string
+	// ports is nil if the policy targets all ports of the service.
+	ports []uint32
+}
+
+// PreservePrecedence adjusts the beta policies converted from all alpha authentication policies in the mesh so that
+// the effective behavior on each workload follows the alpha precedence. In alpha, a service level policy completely
+// replaces the namespace level policy which in turn replaces the mesh level policy, including the origins. In beta,
+// the PeerAuthentication follows the same precedence but the RequestAuthentication and AuthorizationPolicy at all
+// levels are combined:
+//   - The namespace (or mesh) level AuthorizationPolicy requiring JWT is replaced by the copies applied to the services
+//     (or namespaces) not overridden by a more specific alpha policy, with the overridden ports excluded;
+//   - The AuthorizationPolicy requiring JWT only accepts the issuers of its own alpha policy if a RequestAuthentication
+//     from another level also applies to the workloads.
+//
+// The JWT issuers of a broader level that are still validated on the workloads are reported as warnings. The issues
+// are attributed to the alpha policy each beta policy is converted from.
+func (mc *Converter) PreservePrecedence(outputs []*OutputPolicy) ([]*OutputPolicy, SourceResults) {
+	results := SourceResults{}
+	targets := map[string][]*serviceTarget{}
+	namespacePolicies := map[string]bool{}
+	overridden := false
+	for _, output := range outputs {
+		switch outputLevel(output) {
+		case namespaceLevel:
+			namespacePolicies[output.Namespace] = true
+			overridden = true
+			if output.Namespace == mc.RootNamespace {
+				results.of(output.Source).addError(CodeRootNamespacePolicy, "", fmt.Sprintf("%s is a namespace level policy in the root "+
+					"namespace %s, it is converted to beta policies that apply to the whole mesh", output.Source, mc.RootNamespace))
+			}
+		case serviceLevel:
+			overridden = true
+			if output.PeerAuthN == nil {
+				continue
+			}
+			target := &serviceTarget{labels: outputLabels(output)}
+			if output.PeerAuthN.Mtls == nil {
+				for port := range output.PeerAuthN.PortLevelMtls {
+					target.ports = append(target.ports, port)
+				}
+				sort.Slice(target.ports, func(i, j int) bool { return target.ports[i] < target.ports[j] })
+			}
+			targets[output.Namespace] = append(targets[output.Namespace], target)
+		}
+	}
+
+	mc.restrictRequestPrincipals(outputs, results)
+
+	var ret []*OutputPolicy
+	for _, output := range outputs {
+		var copies []*OutputPolicy
+		switch level := outputLevel(output); {
+		case output.Authz != nil && level == namespaceLevel && len(targets[output.Namespace]) != 0:
+			copies = mc.expandToServices(output, output.Namespace, targets[output.Namespace], results.of(output.Source))
+		case output.Authz != nil && level == meshLevel && overridden:
+			copies = mc.expandToNamespaces(output, targets, namespacePolicies, results.of(output.Source))
+		default:
+			ret = append(ret, output)
+			continue
+		}
+		// The JWT requirement is replaced by the copies, the RequestAuthentication is kept.
+		output.Authz = nil
+		if output.RequestAuthN != nil {
+			ret = append(ret, output)
+		}
+		ret = append(ret, copies...)
+	}
+	return ret, results
+}
+
+// expandToNamespaces returns the copies of the mesh level AuthorizationPolicy requiring JWT for the namespaces that are
+// not overridden by a namespace level alpha policy, the copies are further expanded to the services in the namespaces
+// with service level alpha policies.
+func (mc *Converter) expandToNamespaces(output *OutputPolicy, targets map[string][]*serviceTarget, namespacePolicies map[string]bool,
+	result *ResultSummary) []*OutputPolicy {
+	namespaces := map[string]bool{}
+	for _, svc := range mc.Service.Services {
+		namespaces[svc.Namespace] = true
+	}
+	for _, ns := range mc.Service.Namespaces {
+		namespaces[ns] = true
+	}
+	for ns := range targets {
+		namespaces[ns] = true
+	}
+	var sorted []string
+	for ns := range namespaces {
+		if !namespacePolicies[ns] {
+			sorted = append(sorted, ns)
+		}
+	}
+	sort.Strings(sorted)
+
+	ret := []*OutputPolicy{}
+	for _, ns := range sorted {
+		// The policy without selector in the root namespace applies to the whole mesh, use the services instead.
+		if len(targets[ns]) != 0 || ns == mc.RootNamespace {
+			ret = append(ret, mc.expandToServices(output, ns, targets[ns], result)...)
+			continue
+		}
+		authz := proto.Clone(output.Authz).(*betapb.AuthorizationPolicy)
+		ret = append(ret, expandedOutput(output, output.Name, ns, fmt.Sprintf("namespace %s", ns), authz))
+	}
+	result.addError(CodeJWTRequirementExpanded, "", fmt.Sprintf("the JWT requirement of %s is overridden by namespace "+
+		"or service level policies, it is converted to %d AuthorizationPolicies for the namespaces [%s], namespaces "+
+		"created later do not require JWT, suppress the error once reviewed", output.Source, len(ret), strings.Join(sorted, ", ")))
+	return ret
+}
+
+// expandToServices returns the copies of the AuthorizationPolicy requiring JWT for the services in the namespace that
+// are not targeted by a service level alpha policy, the ports targeted by the service level alpha policy are excluded.
+func (mc *Converter) expandToServices(output *OutputPolicy, namespace string, targets []*serviceTarget, result *ResultSummary) []*OutputPolicy {
+	ret := []*OutputPolicy{}
+	var names []string
+	for _, svc := range mc.Service.servicesInNamespace(namespace, nil) {
+		if len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		var notPorts []uint32
+		whole := false
+		for _, target := range targets {
+			if reflect.DeepEqual(target.labels, svc.Spec.Selector) {
+				whole = whole || target.ports == nil
+				notPorts = append(notPorts, target.ports...)
+			}
+		}
+		if whole {
+			continue
+		}
+		authz := proto.Clone(output.Authz).(*betapb.AuthorizationPolicy)
+		authz.Selector = &commonpb.WorkloadSelector{MatchLabels: svc.Spec.Selector}
+		comment := fmt.Sprintf("service %s", svc.Name)
+		if len(notPorts) != 0 {
+			comment = fmt.Sprintf("service %s except ports %s", svc.Name, strings.Join(toStr(notPorts), ", "))
+			for _, rule := range authz.Rules {
+				if len(rule.To) == 0 {
+					rule.To = []*betapb.Rule_To{{Operation: &betapb.Operation{}}}
+				}
+				for _, to := range rule.To {
+					to.Operation.NotPorts = append(to.Operation.NotPorts, toStr(notPorts)...)
+				}
+			}
+		}
+		ret = append(ret, expandedOutput(output, fmt.Sprintf("%s-%s", output.Name, svc.Name), namespace, comment, authz))
+		names = append(names, svc.Name)
+	}
+	// Reported for each namespace, including the namespaces the mesh level policy is expanded to.
+	result.addError(CodeJWTRequirementExpanded, "", fmt.Sprintf("the JWT requirement of %s is overridden by service "+
+		"level policies, it is converted to %d AuthorizationPolicies for the services [%s] in namespace %s, the "+
+		"workloads not selected by these services (including the services without selector) do not require JWT, "+
+		"suppress the error once reviewed", output.Source, len(ret), strings.Join(names, ", "), namespace))
+	return ret
+}
+
+func expandedOutput(output *OutputPolicy, name, namespace, comment string, authz *betapb.AuthorizationPolicy) *OutputPolicy {
+	return &OutputPolicy{
+		Name:      name,
+		Namespace: namespace,
+		Comment:   fmt.Sprintf("%s, JWT requirement applied to %s to preserve the alpha policy precedence", output.Comment, comment),
+		Source:    output.Source,
+		Labels:    output.Labels,
+		Authz:     authz,
+	}
+}
+
+// LocalizeMeshLevel copies the mesh level beta policy in the root namespace to each of the namespaces, it is used to
+// migrate only some namespaces without changing the root namespace. The PeerAuthentication is not copied to the
+// namespace that already has a namespace level PeerAuthentication as it overrides the mesh level one.
+func (mc *Converter) LocalizeMeshLevel(output *OutputPolicy, namespaces []string, outputs []*OutputPolicy) []*OutputPolicy {
+	if output.Namespace != mc.RootNamespace || outputLevel(output) != meshLevel || len(outputLabels(output)) != 0 {
+		return nil
+	}
+	var ret []*OutputPolicy
+	for _, ns := range namespaces {
+		if output.PeerAuthN != nil && hasNamespacePeerAuthN(outputs, ns) {
+			continue
+		}
+		copied := &OutputPolicy{
+			Name:      output.Name + "-mesh",
+			Namespace: ns,
+			Comment:   fmt.Sprintf("%s, applied to namespace %s as the root namespace is not migrated", output.Comment, ns),
+			Source:    output.Source,
+			Labels:    output.Labels,
+		}
+		if output.PeerAuthN != nil {
+			copied.PeerAuthN = proto.Clone(output.PeerAuthN).(*betapb.PeerAuthentication)
+		}
+		if output.RequestAuthN != nil {
+			copied.RequestAuthN = proto.Clone(output.RequestAuthN).(*betapb.RequestAuthentication)
+		}
+		if output.Authz != nil {
+			copied.Authz = proto.Clone(output.Authz).(*betapb.AuthorizationPolicy)
+		}
+		ret = append(ret, copied)
+	}
+	return ret
+}
+
+func hasNamespacePeerAuthN(outputs []*OutputPolicy, namespace string) bool {
+	for _, out := range outputs {
+		if out.Namespace == namespace && out.PeerAuthN != nil && len(out.PeerAuthN.Selector.GetMatchLabels()) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictRequestPrincipals restricts the AuthorizationPolicy requiring JWT to the issuers of its own alpha policy if
+// the RequestAuthentication converted from another policy also applies to the same workloads, otherwise the JWT of the
+// other issuers is also accepted in beta.
+func (mc *Converter) restrictRequestPrincipals(outputs []*OutputPolicy, results SourceResults) {
+	for _, output := range outputs {
+		level := outputLevel(output)
+		if level == meshLevel {
+			continue
+		}
+		own := map[string]bool{}
+		for _, issuer := range jwtIssuers(output) {
+			own[issuer] = true
+		}
+		var others []string
+		for _, other := range outputs {
+			if other.RequestAuthN == nil || other.Source == output.Source {
+				continue
+			}
+			otherLevel := outputLevel(other)
+			applies := otherLevel == meshLevel || (otherLevel == namespaceLevel && other.Namespace == output.Namespace && level == serviceLevel)
+			if !applies {
+				continue
+			}
+			for _, issuer := range jwtIssuers(other) {
+				if !own[issuer] {
+					others = append(others, fmt.Sprintf("%s (from %s)", issuer, other.Source))
+				}
+			}
+		}
+		if len(others) == 0 {
+			continue
+		}
+		if output.Authz == nil {
+			if output.PeerAuthN != nil && !requiresJWT(outputs, output) {
+				results.of(output.Source).addWarning(CodeJWTIssuerInherited, "", fmt.Sprintf("the JWT of issuers %s is still validated on the "+
+					"workloads of %s/%s converted from %s, request with invalid JWT of these issuers is rejected unlike in alpha",
+					strings.Join(others, ", "), output.Namespace, output.Name, output.Source))
+			}
+			continue
+		}
+		var principals []string
+		for _, issuer := range jwtIssuers(output) {
+			principals = append(principals, issuer+"/*")
+		}
+		for _, rule := range output.Authz.Rules {
+			for _, from := range rule.From {
+				if reflect.DeepEqual(from.Source.GetNotRequestPrincipals(), []string{"*"}) {
+					from.Source.NotRequestPrincipals = principals
+				}
+			}
+		}
+		output.Comment = fmt.Sprintf("%s, only accepts JWT of its own issuers", output.Comment)
+	}
+}
+
+// requiresJWT returns true if the alpha policy target of the output is converted with an AuthorizationPolicy requiring
+// JWT, which is in a separate output with the same name.
+func requiresJWT(outputs []*OutputPolicy, output *OutputPolicy) bool {
+	for _, other := range outputs {
+		if other.Source == output.Source && other.Namespace == output.Namespace && other.Name == output.Name && other.Authz != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestConverter_PreservePrecedence(t *testing.T) {
+	service := func(name, namespace string, port, targetPort int32) corev1.Service {
+		return corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": name},
+				Ports:    []corev1.ServicePort{{Port: port, TargetPort: intstr.FromInt(int(targetPort))}},
+			},
+		}
+	}
+	mc := NewConverter("istio-system", &corev1.ServiceList{Items: []corev1.Service{
+		service("httpbin", "foo", 8000, 80),
+		service("productpage", "foo", 9080, 9080),
+		service("reviews", "bar", 9080, 9080),
+	}})
+
+	var outputs []*OutputPolicy
+	for _, input := range []string{`
+apiVersion: authentication.istio.io/v1alpha1
+kind: MeshPolicy
+metadata:
+  name: default
+spec:
+  peers:
+  - mtls: {}
+  origins:
+  - jwt:
+      issuer: iss-mesh
+`, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+spec:
+  origins:
+  - jwt:
+      issuer: iss-ns
+`, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: foo
+spec:
+  targets:
+  - name: httpbin
+    ports:
+    - number: 8000
+  origins:
+  - jwt:
+      issuer: iss-svc
+`} {
+		output, summary := mc.Convert(inputPolicy(t, input))
+		if len(summary.Errors) != 0 {
+			t.Fatalf("failed to convert %s: %v", input, summary.Errors)
+		}
+		outputs = append(outputs, output...)
+	}
+
+	got, results := mc.PreservePrecedence(outputs)
+	summary := results.Summary()
+	if len(summary.Errors) != 2 || summary.Errors[0].Code != CodeJWTRequirementExpanded || summary.Errors[1].Code != CodeJWTRequirementExpanded {
+		t.Errorf("want 2 errors %s but got %v", CodeJWTRequirementExpanded, summary.Errors)
+	}
+	var gotSources []string
+	for _, source := range results.Sources() {
+		if len(results[source].Errors) != 0 {
+			gotSources = append(gotSources, source.String())
+		}
+	}
+	if wantSources := []string{"MeshPolicy/default", "Policy/foo/default"}; !reflect.DeepEqual(gotSources, wantSources) {
+		t.Errorf("want the errors attributed to %v but got %v", wantSources, gotSources)
+	}
+
+	type authz struct {
+		principals []string
+		notPorts   []string
+		selector   map[string]string
+	}
+	want := map[string]*authz{
+		"foo/httpbin-httpbin":     {principals: []string{"iss-svc/*"}, notPorts: nil, selector: map[string]string{"app": "httpbin"}},
+		"foo/default-httpbin":     {principals: []string{"iss-ns/*"}, notPorts: []string{"80"}, selector: map[string]string{"app": "httpbin"}},
+		"foo/default-productpage": {principals: []string{"iss-ns/*"}, notPorts: nil, selector: map[string]string{"app": "productpage"}},
+		"bar/default":             {principals: []string{"*"}, notPorts: nil, selector: nil},
+	}
+	for _, output := range got {
+		key := output.Namespace + "/" + output.Name
+		if output.Authz == nil {
+			continue
+		}
+		w, found := want[key]
+		if !found {
+			t.Errorf("got unexpected AuthorizationPolicy %s: %v", key, output.Authz)
+			continue
+		}
+		delete(want, key)
+		from := output.Authz.Rules[0].From[0].Source
+		if !reflect.DeepEqual(from.NotRequestPrincipals, w.principals) {
+			t.Errorf("%s: want notRequestPrincipals %v but got %v", key, w.principals, from.NotRequestPrincipals)
+		}
+		var notPorts []string
+		for _, to := range output.Authz.Rules[0].To {
+			notPorts = append(notPorts, to.Operation.NotPorts...)
+		}
+		if !reflect.DeepEqual(notPorts, w.notPorts) {
+			t.Errorf("%s: want notPorts %v but got %v", key, w.notPorts, notPorts)
+		}
+		if !reflect.DeepEqual(output.Authz.Selector.GetMatchLabels(), w.selector) {
+			t.Errorf("%s: want selector %v but got %v", key, w.selector, output.Authz.Selector.GetMatchLabels())
+		}
+		if output.Source.Kind == "" {
+			t.Errorf("%s: want source but got none", key)
+		}
+	}
+	for key := range want {
+		t.Errorf("want AuthorizationPolicy %s but got none", key)
+	}
+}
+
+func TestConverter_LocalizeMeshLevel(t *testing.T) {
+	mc := NewConverter("istio-system", nil)
+	meshPolicy, summary := mc.Convert(inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: MeshPolicy
+metadata:
+  name: default
+spec:
+  peers:
+  - mtls: {}
+  origins:
+  - jwt:
+      issuer: iss-mesh
+`))
+	if len(summary.Errors) != 0 {
+		t.Fatalf("failed to convert MeshPolicy: %v", summary.Errors)
+	}
+	fooPolicy, summary := mc.Convert(inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+spec:
+  peers:
+  - mtls:
+      mode: PERMISSIVE
+`))
+	if len(summary.Errors) != 0 {
+		t.Fatalf("failed to convert Policy: %v", summary.Errors)
+	}
+	outputs := append(meshPolicy, fooPolicy...)
+
+	got := map[string]bool{}
+	for _, output := range meshPolicy {
+		for _, localized := range mc.LocalizeMeshLevel(output, []string{"foo", "bar"}, outputs) {
+			for _, ref := range localized.References() {
+				got[ref.String()] = true
+			}
+		}
+	}
+	want := map[string]bool{
+		"PeerAuthentication/bar/default-mesh":    true,
+		"RequestAuthentication/foo/default-mesh": true,
+		"RequestAuthentication/bar/default-mesh": true,
+		"AuthorizationPolicy/foo/default-mesh":   true,
+		"AuthorizationPolicy/bar/default-mesh":   true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v but got %v", want, got)
+	}
+	if localized := mc.LocalizeMeshLevel(fooPolicy[0], []string{"bar"}, outputs); len(localized) != 0 {
+		t.Errorf("want namespace level policy not localized but got %v", localized)
+	}
+}
@@ -0,0 +1,655 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	authnpb "istio.io/api/authentication/v1alpha1"
+	rbacpb "istio.io/api/rbac/v1alpha1"
+	betapb "istio.io/api/security/v1beta1"
+	commonpb "istio.io/api/type/v1beta1"
+)
+
+// serviceDomainSuffix is the domain suffix used by the v1alpha1 RBAC to match the service name.
+const serviceDomainSuffix = "svc.cluster.local"
+
+// InputRbac includes all the v1alpha1 RBAC resources in the mesh.
+type InputRbac struct {
+	Configs  []*InputRbacConfig
+	Roles    []*InputServiceRole
+	Bindings []*InputServiceRoleBinding
+}
+
+// InputRbacConfig includes a v1alpha1 ClusterRbacConfig or the deprecated RbacConfig.
+type InputRbacConfig struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Config    *rbacpb.RbacConfig
+}
+
+// InputServiceRole includes a v1alpha1 ServiceRole.
+type InputServiceRole struct {
+	Name      string
+	Namespace string
+	Role      *rbacpb.ServiceRole
+}
+
+// InputServiceRoleBinding includes a v1alpha1 ServiceRoleBinding.
+type InputServiceRoleBinding struct {
+	Name      string
+	Namespace string
+	Binding   *rbacpb.ServiceRoleBinding
+}
+
+// Config returns the effective RBAC config, the ClusterRbacConfig takes precedence over the deprecated RbacConfig.
+func (input *InputRbac) Config() *InputRbacConfig {
+	var ret *InputRbacConfig
+	for _, config := range input.Configs {
+		if ret == nil || (config.Kind == "ClusterRbacConfig" && ret.Kind != "ClusterRbacConfig") {
+			ret = config
+		}
+	}
+	return ret
+}
+
+func (input *InputRbac) findRole(name, namespace string) *InputServiceRole {
+	for _, role := range input.Roles {
+		if role.Name == name && role.Namespace == namespace {
+			return role
+		}
+	}
+	return nil
+}
+
+// ConvertRbacConfig converts the v1alpha1 RBAC config to the v1beta1 authorization policies that deny all requests
+// by default for the services and namespaces with RBAC enabled.
+func (mc *Converter) ConvertRbacConfig(input *InputRbac) ([]*OutputPolicy, *ResultSummary) {
+	result := &ResultSummary{}
+	config := input.Config()
+	if config == nil {
+		if len(input.Bindings) != 0 {
+			result.addError(CodeRbacConfigNotFound, "", "RBAC config not found, RBAC is not enabled and the ServiceRoleBinding is not enforced, "+
+				"remove the ServiceRole and ServiceRoleBinding as they have no effect")
+		}
+		return nil, result
+	}
+	if len(input.Configs) > 1 {
+		result.addError(CodeRbacConfigDuplicate, "", fmt.Sprintf("found %d RBAC configs, only 1 should be created in the mesh", len(input.Configs)))
+	}
+	if config.Config.EnforcementMode == rbacpb.EnforcementMode_PERMISSIVE {
+		result.addError(CodeEnforcementPermissive, "spec.enforcementMode", "enforcementMode PERMISSIVE is not supported in beta policy")
+	}
+
+	comment := fmt.Sprintf("converted from alpha %s %s", config.Kind, config.Name)
+	denyAll := func(name, namespace string, selector *commonpb.WorkloadSelector) *OutputPolicy {
+		return &OutputPolicy{
+			Name:      name,
+			Namespace: namespace,
+			Comment:   comment + ", deny all requests by default",
+			Authz:     &betapb.AuthorizationPolicy{Selector: selector},
+		}
+	}
+	allowAll := func(name, namespace string, selector *commonpb.WorkloadSelector) *OutputPolicy {
+		return &OutputPolicy{
+			Name:      name,
+			Namespace: namespace,
+			Comment:   comment + ", allow all requests as RBAC is not enabled",
+			Authz:     &betapb.AuthorizationPolicy{Selector: selector, Rules: []*betapb.Rule{{}}},
+		}
+	}
+	serviceSelector := func(field, fqdn string) (string, string, *commonpb.WorkloadSelector) {
+		name, namespace, err := parseServiceFQDN(fqdn)
+		if err != nil {
+			result.addError(CodeInvalidServiceName, field, err.Error())
+			return "", "", nil
+		}
+		selector, err := mc.Service.serviceToSelector(name, namespace)
+		if err != nil {
+			result.addError(CodeServiceNotFound, field, fmt.Sprintf("failed to convert service (%s) to workload selector: %v", fqdn, err))
+			return "", "", nil
+		}
+		return name, namespace, selector
+	}
+
+	var output []*OutputPolicy
+	switch config.Config.Mode {
+	case rbacpb.RbacConfig_OFF:
+		return nil, result
+	case rbacpb.RbacConfig_ON:
+		output = append(output, denyAll("deny-all", mc.RootNamespace, nil))
+	case rbacpb.RbacConfig_ON_WITH_INCLUSION:
+		for _, ns := range config.Config.GetInclusion().GetNamespaces() {
+			output = append(output, denyAll("deny-all", ns, nil))
+		}
+		for i, svc := range config.Config.GetInclusion().GetServices() {
+			if name, namespace, selector := serviceSelector(fmt.Sprintf("spec.inclusion.services[%d]", i), svc); selector != nil {
+				output = append(output, denyAll("deny-all-"+name, namespace, selector))
+			}
+		}
+	case rbacpb.RbacConfig_ON_WITH_EXCLUSION:
+		// The allow-all policy for excluded namespaces and services overrides the mesh level deny-all policy.
+		output = append(output, denyAll("deny-all", mc.RootNamespace, nil))
+		for _, ns := range config.Config.GetExclusion().GetNamespaces() {
+			output = append(output, allowAll("allow-all", ns, nil))
+		}
+		for i, svc := range config.Config.GetExclusion().GetServices() {
+			if name, namespace, selector := serviceSelector(fmt.Sprintf("spec.exclusion.services[%d]", i), svc); selector != nil {
+				output = append(output, allowAll("allow-all-"+name, namespace, selector))
+			}
+		}
+	default:
+		result.addError(CodeRbacModeUnsupported, "spec.mode", fmt.Sprintf("found unsupported RBAC mode %s", config.Config.Mode))
+	}
+	setSource(output, "rbac.istio.io/v1alpha1", config.Kind, config.Namespace, config.Name)
+	return output, result
+}
+
+// ConvertRbacBinding converts a v1alpha1 ServiceRoleBinding together with its ServiceRole to the v1beta1
+// authorization policies with ALLOW action.
+func (mc *Converter) ConvertRbacBinding(input *InputRbac, binding *InputServiceRoleBinding) ([]*OutputPolicy, *ResultSummary) {
+	result := &ResultSummary{}
+	config := input.Config()
+	if config == nil || config.Config.Mode == rbacpb.RbacConfig_OFF {
+		// RBAC is not enabled, the binding has no effect and there is nothing to convert.
+		return nil, result
+	}
+	if len(binding.Binding.Subjects) == 0 {
+		result.addError(CodeSubjectNotFound, "spec.subjects", "no subjects specified, the binding never matches any request")
+		return nil, result
+	}
+	if binding.Binding.Mode == rbacpb.EnforcementMode_PERMISSIVE {
+		result.addError(CodeEnforcementPermissive, "spec.mode", "mode PERMISSIVE is not supported in beta policy")
+	}
+
+	accessRules, rulesField := binding.Binding.Actions, "spec.actions"
+	if len(accessRules) == 0 {
+		roleName, roleNamespace := binding.Binding.GetRoleRef().GetName(), binding.Namespace
+		if binding.Binding.Role != "" {
+			roleName = binding.Binding.Role
+			if strings.HasPrefix(roleName, "/") {
+				roleName, roleNamespace = strings.TrimPrefix(roleName, "/"), mc.RootNamespace
+			}
+		} else if kind := binding.Binding.GetRoleRef().GetKind(); kind != "ServiceRole" {
+			result.addError(CodeRoleRefUnsupported, "spec.roleRef.kind", fmt.Sprintf("found unsupported roleRef kind %q", kind))
+			return nil, result
+		}
+		role := input.findRole(roleName, roleNamespace)
+		if role == nil {
+			result.addError(CodeRoleNotFound, "spec.roleRef", fmt.Sprintf("could not find ServiceRole %s/%s", roleNamespace, roleName))
+			return nil, result
+		}
+		accessRules, rulesField = role.Role.Rules, fmt.Sprintf("serviceRole[%s/%s].spec.rules", roleNamespace, roleName)
+	}
+
+	enforced := func(svc string) bool {
+		return rbacEnforced(config.Config, binding.Namespace, svc)
+	}
+	namespaceEnforced := rbacNamespaceEnforced(config.Config, binding.Namespace)
+	if !namespaceEnforced && len(mc.Service.servicesInNamespace(binding.Namespace, enforced)) == 0 {
+		// RBAC is not enabled for any service in the namespace, the binding has no effect.
+		return nil, result
+	}
+
+	from, subjectRules, anySource := convertSubjects(binding.Binding.Subjects, result)
+
+	// Group the beta rules by the workload selector, each workload selector is used in a new beta policy.
+	var output []*OutputPolicy
+	policyBySelector := map[string]*OutputPolicy{}
+	addRule := func(name, comment string, labels map[string]string, rule *betapb.Rule) {
+		var selector *commonpb.WorkloadSelector
+		if len(labels) != 0 {
+			selector = &commonpb.WorkloadSelector{MatchLabels: labels}
+		}
+		key := labelsToString(labels)
+		policy, found := policyBySelector[key]
+		if !found {
+			policy = &OutputPolicy{
+				Name:      name,
+				Namespace: binding.Namespace,
+				Comment:   fmt.Sprintf("converted from alpha ServiceRoleBinding %s/%s, %s", binding.Namespace, binding.Name, comment),
+				Authz:     &betapb.AuthorizationPolicy{Selector: selector, Action: betapb.AuthorizationPolicy_ALLOW},
+			}
+			policyBySelector[key] = policy
+			output = append(output, policy)
+		}
+		policy.Authz.Rules = append(policy.Authz.Rules, rule)
+	}
+
+	for i, accessRule := range accessRules {
+		ruleField := fmt.Sprintf("%s[%d]", rulesField, i)
+		to, when, labels, ok := convertAccessRule(accessRule, binding.Namespace, i, ruleField, result)
+		if !ok {
+			continue
+		}
+		newRules := func() []*betapb.Rule {
+			var ret []*betapb.Rule
+			if anySource {
+				return []*betapb.Rule{{To: to, When: when}}
+			}
+			if len(from) != 0 {
+				ret = append(ret, &betapb.Rule{From: from, To: to, When: when})
+			}
+			for _, subjectRule := range subjectRules {
+				ret = append(ret, &betapb.Rule{
+					From: subjectRule.From,
+					To:   to,
+					When: append(append([]*betapb.Condition{}, when...), subjectRule.When...),
+				})
+			}
+			return ret
+		}
+
+		var targets []*targetService
+		if containsString(accessRule.Services, "*") && namespaceEnforced {
+			targets = []*targetService{{Comment: "namespace level policy"}}
+		} else {
+			for _, svc := range mc.Service.servicesInNamespace(binding.Namespace, enforced) {
+				if matchServiceName(accessRule.Services, svc.Name, svc.Namespace) {
+					targets = append(targets, &targetService{
+						Name:    svc.Name,
+						Comment: fmt.Sprintf("service %s", svc.Name),
+						Labels:  svc.Spec.Selector,
+					})
+				}
+			}
+			if len(targets) == 0 {
+				result.addError(CodeServiceNotFound, ruleField+".services", fmt.Sprintf("rules[%d]: could not find any service with RBAC enabled matching %v in namespace %s",
+					i, accessRule.Services, binding.Namespace))
+				continue
+			}
+		}
+
+		for _, target := range targets {
+			name := binding.Name
+			if target.Name != "" {
+				name = fmt.Sprintf("%s-%s", binding.Name, target.Name)
+			}
+			selectorLabels := map[string]string{}
+			for k, v := range target.Labels {
+				selectorLabels[k] = v
+			}
+			conflict := false
+			for k, v := range labels {
+				if old, found := selectorLabels[k]; found && old != v {
+					conflict = true
+				}
+				selectorLabels[k] = v
+			}
+			if conflict {
+				// The destination.labels constraint never matches the service, the rule has no effect.
+				continue
+			}
+			if len(labels) != 0 {
+				name = fmt.Sprintf("%s-rule-%d", name, i)
+			}
+			for _, rule := range newRules() {
+				addRule(name, target.Comment, selectorLabels, rule)
+			}
+		}
+	}
+	for _, policy := range output {
+		mc.applyPrincipalBinding(policy, result)
+	}
+	setSource(output, "rbac.istio.io/v1alpha1", "ServiceRoleBinding", binding.Namespace, binding.Name)
+	return output, result
+}
+
+type targetService struct {
+	Name    string
+	Comment string
+	Labels  map[string]string
+}
+
+// convertAccessRule converts the access rule to the beta operation and conditions. It also returns the labels from
+// the destination.labels constraint that should be added to the workload selector.
+func convertAccessRule(rule *rbacpb.AccessRule, namespace string, index int, field string, result *ResultSummary) ([]*betapb.Rule_To, []*betapb.Condition, map[string]string, bool) {
+	op := &betapb.Operation{
+		Hosts:      rule.Hosts,
+		NotHosts:   rule.NotHosts,
+		Paths:      rule.Paths,
+		NotPaths:   rule.NotPaths,
+		NotMethods: rule.NotMethods,
+		Ports:      int32ToStr(rule.Ports),
+		NotPorts:   int32ToStr(rule.NotPorts),
+	}
+	if !containsString(rule.Methods, "*") {
+		op.Methods = rule.Methods
+	}
+
+	var when []*betapb.Condition
+	labels := map[string]string{}
+	ok := true
+	for j, constraint := range rule.Constraints {
+		key := constraint.Key
+		constraintField := fmt.Sprintf("%s.constraints[%d]", field, j)
+		switch {
+		case key == "destination.ip" || key == "destination.port" || key == "connection.sni" ||
+			strings.HasPrefix(key, "request.headers[") || strings.HasPrefix(key, "experimental.envoy.filters."):
+			when = append(when, &betapb.Condition{Key: key, Values: constraint.Values})
+		case strings.HasPrefix(key, "destination.labels[") && strings.HasSuffix(key, "]"):
+			if len(constraint.Values) != 1 || strings.Contains(constraint.Values[0], "*") {
+				result.addError(CodeConstraintUnsupported, constraintField, fmt.Sprintf("rules[%d]: constraint %s with values %v is not supported, only a single exact value "+
+					"could be converted to the workload selector", index, key, constraint.Values))
+				ok = false
+				continue
+			}
+			labels[strings.TrimSuffix(strings.TrimPrefix(key, "destination.labels["), "]")] = constraint.Values[0]
+		case key == "destination.namespace":
+			if !matchAny(constraint.Values, namespace) {
+				// The rule never matches as the ServiceRole only applies to services in its own namespace.
+				return nil, nil, nil, false
+			}
+		default:
+			result.addError(CodeConstraintUnsupported, constraintField, fmt.Sprintf("rules[%d]: constraint %s is not supported in beta policy", index, key))
+			ok = false
+		}
+	}
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	var to []*betapb.Rule_To
+	if len(op.Hosts)+len(op.NotHosts)+len(op.Paths)+len(op.NotPaths)+len(op.Methods)+len(op.NotMethods)+
+		len(op.Ports)+len(op.NotPorts) != 0 {
+		to = []*betapb.Rule_To{{Operation: op}}
+	}
+	return to, when, labels, true
+}
+
+// convertSubjects converts the subjects to the beta sources. Subjects that could be represented by a source only are
+// merged in the returned sources, subjects that also require conditions are returned as separate rules. It returns
+// true if any subject matches any source.
+func convertSubjects(subjects []*rbacpb.Subject, result *ResultSummary) ([]*betapb.Rule_From, []*betapb.Rule, bool) {
+	var from []*betapb.Rule_From
+	var rules []*betapb.Rule
+	anySubject := false
+	for i, subject := range subjects {
+		source := &betapb.Source{
+			Principals:    subject.Names,
+			NotPrincipals: subject.NotNames,
+			Namespaces:    subject.Namespaces,
+			NotNamespaces: subject.NotNamespaces,
+			IpBlocks:      subject.Ips,
+			NotIpBlocks:   subject.NotIps,
+		}
+		if subject.User != "" && subject.User != "*" {
+			source.Principals = append(source.Principals, subject.User)
+		}
+
+		var when []*betapb.Condition
+		groups := subject.Groups
+		if subject.Group != "" {
+			groups = append(groups, subject.Group)
+		}
+		if len(groups) != 0 || len(subject.NotGroups) != 0 {
+			when = append(when, &betapb.Condition{Key: "request.auth.claims[groups]", Values: groups, NotValues: subject.NotGroups})
+		}
+
+		keys := make([]string, 0, len(subject.Properties))
+		for k := range subject.Properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		supported := true
+		for _, key := range keys {
+			value := subject.Properties[key]
+			switch {
+			case key == "source.ip":
+				source.IpBlocks = append(source.IpBlocks, value)
+			case key == "source.namespace":
+				source.Namespaces = append(source.Namespaces, value)
+			case key == "source.principal" || key == "source.user":
+				source.Principals = append(source.Principals, value)
+			case key == "request.auth.principal":
+				source.RequestPrincipals = append(source.RequestPrincipals, value)
+			case key == "request.auth.audiences" || key == "request.auth.presenter" ||
+				strings.HasPrefix(key, "request.auth.claims[") || strings.HasPrefix(key, "request.headers["):
+				when = append(when, &betapb.Condition{Key: key, Values: []string{value}})
+			default:
+				result.addError(CodePropertyUnsupported, fmt.Sprintf("spec.subjects[%d].properties[%s]", i, key),
+					fmt.Sprintf("subjects[%d]: property %s is not supported in beta policy", i, key))
+				supported = false
+			}
+		}
+		if !supported {
+			// Skip the subject to avoid generating a rule that is more permissive than the original one.
+			continue
+		}
+
+		var ruleFrom []*betapb.Rule_From
+		if len(source.Principals)+len(source.NotPrincipals)+len(source.RequestPrincipals)+len(source.Namespaces)+
+			len(source.NotNamespaces)+len(source.IpBlocks)+len(source.NotIpBlocks) != 0 {
+			ruleFrom = []*betapb.Rule_From{{Source: source}}
+		}
+		switch {
+		case len(when) != 0:
+			rules = append(rules, &betapb.Rule{From: ruleFrom, When: when})
+		case len(ruleFrom) == 0:
+			// The subject matches any source.
+			anySubject = true
+		default:
+			from = append(from, ruleFrom...)
+		}
+	}
+	if anySubject {
+		return nil, nil, true
+	}
+	return from, rules, false
+}
+
+// rbacNamespaceEnforced returns true if the RBAC is enabled for the whole namespace.
+func rbacNamespaceEnforced(config *rbacpb.RbacConfig, namespace string) bool {
+	switch config.Mode {
+	case rbacpb.RbacConfig_ON:
+		return true
+	case rbacpb.RbacConfig_ON_WITH_INCLUSION:
+		return containsString(config.GetInclusion().GetNamespaces(), namespace)
+	case rbacpb.RbacConfig_ON_WITH_EXCLUSION:
+		return !containsString(config.GetExclusion().GetNamespaces(), namespace)
+	}
+	return false
+}
+
+// rbacEnforced returns true if the RBAC is enabled for the service.
+func rbacEnforced(config *rbacpb.RbacConfig, namespace, service string) bool {
+	fqdn := fmt.Sprintf("%s.%s.%s", service, namespace, serviceDomainSuffix)
+	switch config.Mode {
+	case rbacpb.RbacConfig_ON_WITH_INCLUSION:
+		return rbacNamespaceEnforced(config, namespace) || containsString(config.GetInclusion().GetServices(), fqdn)
+	case rbacpb.RbacConfig_ON_WITH_EXCLUSION:
+		return rbacNamespaceEnforced(config, namespace) && !containsString(config.GetExclusion().GetServices(), fqdn)
+	}
+	return rbacNamespaceEnforced(config, namespace)
+}
+
+func parseServiceFQDN(fqdn string) (string, string, error) {
+	parts := strings.SplitN(fqdn, ".", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid service name %q, must be in the form of <name>.<namespace>.%s", fqdn, serviceDomainSuffix)
+	}
+	return parts[0], parts[1], nil
+}
+
+// matchServiceName returns true if the service matches to any of the names. Exact, prefix and suffix match are
+// supported as in the v1alpha1 RBAC.
+func matchServiceName(names []string, service, namespace string) bool {
+	return matchAny(names, fmt.Sprintf("%s.%s.%s", service, namespace, serviceDomainSuffix))
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		switch {
+		case pattern == "*":
+			return true
+		case strings.HasPrefix(pattern, "*"):
+			if strings.HasSuffix(value, strings.TrimPrefix(pattern, "*")) {
+				return true
+			}
+		case strings.HasSuffix(pattern, "*"):
+			if strings.HasPrefix(value, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		case pattern == value:
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func labelsToString(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var ret []string
+	for _, k := range keys {
+		ret = append(ret, k+"="+labels[k])
+	}
+	return strings.Join(ret, ",")
+}
+
+func int32ToStr(ports []int32) []string {
+	var ret []string
+	for _, p := range ports {
+		ret = append(ret, fmt.Sprintf("%d", p))
+	}
+	return ret
+}
+
+// principalBinding records the principal binding of an authentication policy applied to the workloads.
+type principalBinding struct {
+	// Namespace is empty for the mesh level policy.
+	Namespace string
+	// Labels is nil for the namespace and mesh level policy.
+	Labels    map[string]string
+	Workload  string
+	UseOrigin bool
+}
+
+func (mc *Converter) recordPrincipalBinding(input *InputPolicy, selectors []*outputSelector) {
+	useOrigin := input.Policy.PrincipalBinding == authnpb.PrincipalBinding_USE_ORIGIN
+	for _, selector := range selectors {
+		binding := &principalBinding{Namespace: input.Namespace, UseOrigin: useOrigin}
+		switch {
+		case selector.Selector != nil:
+			binding.Labels = selector.Selector.MatchLabels
+			binding.Workload = fmt.Sprintf("%s in namespace %s (policy %s/%s)", selector.Comment, input.Namespace, input.Namespace, input.Name)
+		case input.Namespace == "":
+			binding.Workload = fmt.Sprintf("mesh (policy %s)", input.Name)
+		default:
+			binding.Workload = fmt.Sprintf("namespace %s (policy %s/%s)", input.Namespace, input.Namespace, input.Name)
+		}
+		mc.principalBindings = append(mc.principalBindings, binding)
+	}
+}
+
+// principalBindingsFor returns the principal bindings that apply to the workloads selected by the labels in the
+// namespace, nil labels selects all workloads in the namespace. It also returns true if some of the workloads are not
+// selected by any authentication policy and use the default USE_PEER principal binding.
+func (mc *Converter) principalBindingsFor(namespace string, labels map[string]string) ([]*principalBinding, bool) {
+	var mesh, ns *principalBinding
+	var covered, partial []*principalBinding
+	for _, b := range mc.principalBindings {
+		switch {
+		case b.Namespace == "":
+			mesh = b
+		case b.Namespace != namespace:
+			continue
+		case b.Labels == nil:
+			ns = b
+		case labels == nil:
+			partial = append(partial, b)
+		case labelsSubset(b.Labels, labels):
+			covered = append(covered, b)
+		case labelsCompatible(b.Labels, labels):
+			partial = append(partial, b)
+		}
+	}
+	if len(covered) != 0 {
+		return covered, false
+	}
+	fallback := ns
+	if fallback == nil {
+		fallback = mesh
+	}
+	if fallback == nil {
+		return partial, true
+	}
+	return append([]*principalBinding{fallback}, partial...), false
+}
+
+// applyPrincipalBinding rewrites the principals in the RBAC authorization policy to request principals for workloads
+// using the USE_ORIGIN principal binding, in which case the alpha principal is set from the JWT instead of the peer.
+func (mc *Converter) applyPrincipalBinding(policy *OutputPolicy, result *ResultSummary) {
+	var usePrincipal, useNamespace bool
+	for _, rule := range policy.Authz.GetRules() {
+		for _, from := range rule.From {
+			usePrincipal = usePrincipal || len(from.Source.Principals)+len(from.Source.NotPrincipals) != 0
+			useNamespace = useNamespace || len(from.Source.Namespaces)+len(from.Source.NotNamespaces) != 0
+		}
+	}
+	if !usePrincipal && !useNamespace {
+		return
+	}
+
+	bindings, defaultPeer := mc.principalBindingsFor(policy.Namespace, policy.Authz.GetSelector().GetMatchLabels())
+	var originWorkloads, peerWorkloads []string
+	for _, b := range bindings {
+		if b.UseOrigin {
+			originWorkloads = append(originWorkloads, b.Workload)
+		} else {
+			peerWorkloads = append(peerWorkloads, b.Workload)
+		}
+	}
+	if len(originWorkloads) == 0 {
+		return
+	}
+	if defaultPeer || len(peerWorkloads) != 0 {
+		result.addError(CodePrincipalBindingPartial, "spec.subjects", fmt.Sprintf("principalBinding USE_ORIGIN only applies to some of the workloads selected by %s/%s "+
+			"and could not be converted, workloads with USE_ORIGIN: %s", policy.Namespace, policy.Name, strings.Join(originWorkloads, ", ")))
+		return
+	}
+	if useNamespace {
+		result.addError(CodePrincipalBindingNamespace, "spec.subjects", fmt.Sprintf("source.namespace could not be converted with principalBinding USE_ORIGIN in %s/%s, "+
+			"affected workloads: %s", policy.Namespace, policy.Name, strings.Join(originWorkloads, ", ")))
+		return
+	}
+	for _, rule := range policy.Authz.GetRules() {
+		for _, from := range rule.From {
+			from.Source.RequestPrincipals = append(from.Source.RequestPrincipals, from.Source.Principals...)
+			from.Source.NotRequestPrincipals = append(from.Source.NotRequestPrincipals, from.Source.NotPrincipals...)
+			from.Source.Principals, from.Source.NotPrincipals = nil, nil
+		}
+	}
+	policy.Comment = fmt.Sprintf("%s, principals converted to request principals for principalBinding USE_ORIGIN", policy.Comment)
+}
+
+func labelsSubset(subset, labels map[string]string) bool {
+	for k, v := range subset {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func labelsCompatible(a, b map[string]string) bool {
+	for k, v := range a {
+		if old, found := b[k]; found && old != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,649 @@
+package converter
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kubeyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+func inputRbac(t *testing.T, yaml string) *InputRbac {
+	t.Helper()
+	yamlDecoder := kubeyaml.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(yaml)), 512*1024)
+	var items []unstructured.Unstructured
+	for {
+		obj := map[string]interface{}{}
+		err := yamlDecoder.Decode(&obj)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", yaml, err)
+		}
+		if len(obj) != 0 {
+			items = append(items, unstructured.Unstructured{Object: obj})
+		}
+	}
+	input, err := ConvertToRbac(items)
+	if err != nil {
+		t.Fatalf("failed to convert %s: %v", yaml, err)
+	}
+	return input
+}
+
+func rbacServices() *corev1.ServiceList {
+	return &corev1.ServiceList{
+		Items: []corev1.Service{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "products", Namespace: "default"},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "products"}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "reviews", Namespace: "default"},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "reviews"}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "ratings", Namespace: "foo"},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "ratings"}},
+			},
+		},
+	}
+}
+
+func TestConverter_ConvertRbac_Success(t *testing.T) {
+	cases := []struct {
+		name       string
+		inputRbac  *InputRbac
+		wantOutput []*OutputPolicy
+	}{
+		{
+			name: "mode-on",
+			inputRbac: inputRbac(t, `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ClusterRbacConfig
+metadata:
+  name: default
+spec:
+  mode: "ON"
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRole
+metadata:
+  name: products-viewer
+  namespace: default
+spec:
+  rules:
+  - services: ["*"]
+    methods: ["GET", "HEAD"]
+    paths: ["/products*"]
+    constraints:
+    - key: request.headers[version]
+      values: ["v1", "v2"]
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind-products-viewer
+  namespace: default
+spec:
+  subjects:
+  - user: cluster.local/ns/default/sa/frontend
+  - properties:
+      source.namespace: foo
+  roleRef:
+    kind: ServiceRole
+    name: products-viewer
+`),
+			wantOutput: outputPolicy(t, `
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny-all
+  namespace: istio-system
+spec: {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: bind-products-viewer
+  namespace: default
+spec:
+  rules:
+  - from:
+    - source:
+        principals: ["cluster.local/ns/default/sa/frontend"]
+    - source:
+        namespaces: ["foo"]
+    to:
+    - operation:
+        methods: ["GET", "HEAD"]
+        paths: ["/products*"]
+    when:
+    - key: request.headers[version]
+      values: ["v1", "v2"]
+`),
+		},
+
+		{
+			name: "mode-on-with-inclusion",
+			inputRbac: inputRbac(t, `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ClusterRbacConfig
+metadata:
+  name: default
+spec:
+  mode: ON_WITH_INCLUSION
+  inclusion:
+    services: ["products.default.svc.cluster.local"]
+    namespaces: ["foo"]
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRole
+metadata:
+  name: viewer
+  namespace: default
+spec:
+  rules:
+  - services: ["*"]
+    methods: ["*"]
+    constraints:
+    - key: destination.labels[version]
+      values: ["v1"]
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind-viewer
+  namespace: default
+spec:
+  subjects:
+  - user: "*"
+  roleRef:
+    kind: ServiceRole
+    name: viewer
+`),
+			wantOutput: outputPolicy(t, `
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny-all
+  namespace: foo
+spec: {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny-all-products
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: products
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: bind-viewer-products-rule-0
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: products
+      version: v1
+  rules:
+  - {}
+`),
+		},
+
+		{
+			name: "mode-on-with-exclusion",
+			inputRbac: inputRbac(t, `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ClusterRbacConfig
+metadata:
+  name: default
+spec:
+  mode: ON_WITH_EXCLUSION
+  exclusion:
+    services: ["reviews.default.svc.cluster.local"]
+    namespaces: ["foo"]
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind-inline
+  namespace: default
+spec:
+  subjects:
+  - names: ["cluster.local/ns/default/sa/frontend"]
+    properties:
+      request.auth.claims[group]: admin
+  actions:
+  - services: ["prod*"]
+    ports: [8080]
+`),
+			wantOutput: outputPolicy(t, `
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: deny-all
+  namespace: istio-system
+spec: {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow-all
+  namespace: foo
+spec:
+  rules:
+  - {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: allow-all-reviews
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: reviews
+  rules:
+  - {}
+---
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: bind-inline-products
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: products
+  rules:
+  - from:
+    - source:
+        principals: ["cluster.local/ns/default/sa/frontend"]
+    to:
+    - operation:
+        ports: ["8080"]
+    when:
+    - key: request.auth.claims[group]
+      values: ["admin"]
+`),
+		},
+
+		{
+			name: "mode-off",
+			inputRbac: inputRbac(t, `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ClusterRbacConfig
+metadata:
+  name: default
+spec:
+  mode: "OFF"
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind-inline
+  namespace: default
+spec:
+  subjects:
+  - user: "*"
+  actions:
+  - services: ["*"]
+`),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := NewConverter("istio-system", rbacServices())
+			output, result := mc.ConvertRbacConfig(tc.inputRbac)
+			for _, binding := range tc.inputRbac.Bindings {
+				bindingOutput, bindingResult := mc.ConvertRbacBinding(tc.inputRbac, binding)
+				output = append(output, bindingOutput...)
+				result.Errors = append(result.Errors, bindingResult.Errors...)
+			}
+			if len(result.Errors) != 0 {
+				t.Errorf("want no error but got %v", result.Errors)
+			}
+			compareOutputPolicy(t, output, tc.wantOutput)
+		})
+	}
+}
+
+func TestConverter_ConvertRbac_Fail(t *testing.T) {
+	cases := []struct {
+		wantError string
+		inputRbac *InputRbac
+	}{
+		{
+			wantError: "could not find ServiceRole default/not-exist",
+			inputRbac: inputRbac(t, `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ClusterRbacConfig
+metadata:
+  name: default
+spec:
+  mode: "ON"
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind
+  namespace: default
+spec:
+  subjects:
+  - user: "*"
+  roleRef:
+    kind: ServiceRole
+    name: not-exist
+`),
+		},
+		{
+			wantError: "rules[0]: constraint destination.user is not supported in beta policy",
+			inputRbac: inputRbac(t, `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ClusterRbacConfig
+metadata:
+  name: default
+spec:
+  mode: "ON"
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind
+  namespace: default
+spec:
+  subjects:
+  - user: "*"
+  actions:
+  - services: ["*"]
+    constraints:
+    - key: destination.user
+      values: ["productpage"]
+`),
+		},
+		{
+			wantError: "subjects[0]: property source.unknown is not supported in beta policy",
+			inputRbac: inputRbac(t, `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ClusterRbacConfig
+metadata:
+  name: default
+spec:
+  mode: "ON"
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind
+  namespace: default
+spec:
+  subjects:
+  - properties:
+      source.unknown: foo
+  actions:
+  - services: ["*"]
+`),
+		},
+		{
+			wantError: "rules[0]: could not find any service with RBAC enabled matching [unknown.default.svc.cluster.local]",
+			inputRbac: inputRbac(t, `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ClusterRbacConfig
+metadata:
+  name: default
+spec:
+  mode: "ON"
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind
+  namespace: default
+spec:
+  subjects:
+  - user: "*"
+  actions:
+  - services: ["unknown.default.svc.cluster.local"]
+`),
+		},
+		{
+			wantError: "RBAC config not found",
+			inputRbac: inputRbac(t, `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind
+  namespace: default
+spec:
+  subjects:
+  - user: "*"
+  actions:
+  - services: ["*"]
+`),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.wantError, func(t *testing.T) {
+			mc := NewConverter("istio-system", rbacServices())
+			_, result := mc.ConvertRbacConfig(tc.inputRbac)
+			for _, binding := range tc.inputRbac.Bindings {
+				_, bindingResult := mc.ConvertRbacBinding(tc.inputRbac, binding)
+				result.Errors = append(result.Errors, bindingResult.Errors...)
+			}
+			if len(result.Errors) == 0 {
+				t.Errorf("want error %q but got no error", tc.wantError)
+			}
+			for _, gotErr := range result.Errors {
+				if !strings.HasPrefix(gotErr.Message, tc.wantError) {
+					t.Errorf("want error %q but got %q", tc.wantError, gotErr)
+				}
+			}
+		})
+	}
+}
+
+func TestConverter_ConvertRbac_PrincipalBinding(t *testing.T) {
+	rbac := `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ClusterRbacConfig
+metadata:
+  name: default
+spec:
+  mode: "ON"
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind
+  namespace: default
+spec:
+  subjects:
+  - user: "testing@secure.istio.io/testing@secure.istio.io"
+  actions:
+  - services: ["products.default.svc.cluster.local"]
+`
+	cases := []struct {
+		name        string
+		authnPolicy *InputPolicy
+		rbac        string
+		wantError   string
+		wantOutput  []*OutputPolicy
+	}{
+		{
+			name: "use-origin-namespace-level",
+			authnPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: default
+spec:
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+  principalBinding: USE_ORIGIN
+`),
+			rbac: rbac,
+			wantOutput: outputPolicy(t, `
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: bind-products
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: products
+  rules:
+  - from:
+    - source:
+        requestPrincipals: ["testing@secure.istio.io/testing@secure.istio.io"]
+`),
+		},
+		{
+			name: "use-peer-overrides-namespace-level",
+			authnPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: products
+  namespace: default
+spec:
+  targets:
+  - name: products
+  peers:
+  - mtls: {}
+`),
+			rbac: rbac,
+			wantOutput: outputPolicy(t, `
+apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: bind-products
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: products
+  rules:
+  - from:
+    - source:
+        principals: ["testing@secure.istio.io/testing@secure.istio.io"]
+`),
+		},
+		{
+			name: "use-origin-partial",
+			authnPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: products
+  namespace: default
+spec:
+  targets:
+  - name: products
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+  principalBinding: USE_ORIGIN
+`),
+			rbac: `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ClusterRbacConfig
+metadata:
+  name: default
+spec:
+  mode: "ON"
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind
+  namespace: default
+spec:
+  subjects:
+  - user: "testing@secure.istio.io/testing@secure.istio.io"
+  actions:
+  - services: ["*"]
+`,
+			wantError: "principalBinding USE_ORIGIN only applies to some of the workloads selected by default/bind " +
+				"and could not be converted, workloads with USE_ORIGIN: service products in namespace default (policy default/products)",
+		},
+		{
+			name: "use-origin-source-namespace",
+			authnPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: default
+spec:
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+  principalBinding: USE_ORIGIN
+`),
+			rbac: `
+apiVersion: rbac.istio.io/v1alpha1
+kind: ClusterRbacConfig
+metadata:
+  name: default
+spec:
+  mode: "ON"
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRoleBinding
+metadata:
+  name: bind
+  namespace: default
+spec:
+  subjects:
+  - namespaces: ["foo"]
+  actions:
+  - services: ["*"]
+`,
+			wantError: "source.namespace could not be converted with principalBinding USE_ORIGIN in default/bind, " +
+				"affected workloads: namespace default (policy default/default)",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := NewConverter("istio-system", rbacServices())
+			mc.Convert(tc.authnPolicy)
+			input := inputRbac(t, tc.rbac)
+			var output []*OutputPolicy
+			var gotErrors []*Issue
+			for _, binding := range input.Bindings {
+				bindingOutput, result := mc.ConvertRbacBinding(input, binding)
+				output = append(output, bindingOutput...)
+				gotErrors = append(gotErrors, result.Errors...)
+			}
+			if tc.wantError != "" {
+				if len(gotErrors) != 1 || gotErrors[0].Message != tc.wantError {
+					t.Errorf("want error %q but got %v", tc.wantError, gotErrors)
+				}
+				return
+			}
+			if len(gotErrors) != 0 {
+				t.Errorf("want no error but got %v", gotErrors)
+			}
+			compareOutputPolicy(t, output, tc.wantOutput)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package converter
+
+import (
+	"strings"
+)
+
+// ServiceReferences includes the services needed to convert the alpha policies, it is used to load only these services
+// instead of all services in the cluster.
+type ServiceReferences struct {
+	// Services includes the services referenced by name, keyed by namespace/name.
+	Services map[string]bool
+	// Namespaces includes the namespaces whose services are all needed, e.g. the namespace level policy is converted
+	// for each service in the namespace to preserve the precedence and the ServiceRoleBinding matches the services by
+	// prefix or suffix.
+	Namespaces map[string]bool
+}
+
+// ReferencedServices returns the services referenced by the authentication policies, the mesh config, the RBAC
+// policies and the DestinationRules. The DestinationRule with a wildcard host matching multiple namespaces is ignored.
+func ReferencedServices(rootNamespace string, meshConfig *MeshConfig, policies []*InputPolicy, rbac *InputRbac,
+	rules []*InputDestinationRule) *ServiceReferences {
+	refs := &ServiceReferences{Services: map[string]bool{}, Namespaces: map[string]bool{}}
+	meshLevel := meshConfig != nil && meshConfig.AuthPolicy != ""
+	for _, policy := range policies {
+		for _, target := range policy.Policy.Targets {
+			refs.Services[policy.Namespace+"/"+target.Name] = true
+		}
+		if len(policy.Policy.Targets) == 0 && policy.Namespace != "" {
+			refs.Namespaces[policy.Namespace] = true
+		}
+		meshLevel = meshLevel || policy.Namespace == ""
+	}
+	// The mesh level policy is converted for each service in the namespaces (and the root namespace) with service level
+	// policies to preserve the precedence, all services in these namespaces are needed.
+	if meshLevel {
+		for _, policy := range policies {
+			if len(policy.Policy.Targets) != 0 {
+				refs.Namespaces[policy.Namespace] = true
+			}
+		}
+		refs.Namespaces[rootNamespace] = true
+	}
+
+	if rbac != nil {
+		if config := rbac.Config(); config != nil {
+			services := append(config.Config.GetInclusion().GetServices(), config.Config.GetExclusion().GetServices()...)
+			for _, fqdn := range services {
+				if name, namespace, err := parseServiceFQDN(fqdn); err == nil {
+					refs.Services[namespace+"/"+name] = true
+				}
+			}
+		}
+		for _, binding := range rbac.Bindings {
+			refs.Namespaces[binding.Namespace] = true
+		}
+	}
+
+	for _, rule := range rules {
+		fqdn := hostFQDN(rule.Rule.Host, rule.Namespace)
+		parts := strings.Split(fqdn, ".")
+		if len(parts) != 5 || !strings.HasSuffix(fqdn, "."+serviceDomainSuffix) {
+			continue
+		}
+		if parts[0] == "*" {
+			refs.Namespaces[parts[1]] = true
+		} else if !strings.Contains(parts[0], "*") {
+			refs.Services[parts[1]+"/"+parts[0]] = true
+		}
+	}
+	return refs
+}
@@ -0,0 +1,165 @@
+package converter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	networkingpb "istio.io/api/networking/v1alpha3"
+	rbacpb "istio.io/api/rbac/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReferencedServices(t *testing.T) {
+	policies := []*InputPolicy{
+		inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: MeshPolicy
+metadata:
+  name: default
+spec:
+  peers:
+  - mtls: {}
+`),
+		inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: foo
+spec:
+  targets:
+  - name: httpbin
+  - name: sleep
+`),
+		inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: bar
+spec:
+  peers:
+  - mtls: {}
+`),
+	}
+	rbac := &InputRbac{
+		Configs: []*InputRbacConfig{
+			{
+				Kind: "ClusterRbacConfig",
+				Name: "default",
+				Config: &rbacpb.RbacConfig{
+					Mode:      rbacpb.RbacConfig_ON_WITH_INCLUSION,
+					Inclusion: &rbacpb.RbacConfig_Target{Services: []string{"productpage.qux.svc.cluster.local"}},
+				},
+			},
+		},
+		Bindings: []*InputServiceRoleBinding{{Name: "viewer", Namespace: "baz", Binding: &rbacpb.ServiceRoleBinding{}}},
+	}
+	rules := []*InputDestinationRule{
+		{Name: "short", Namespace: "foo", Rule: &networkingpb.DestinationRule{Host: "reviews"}},
+		{Name: "wildcard", Namespace: "foo", Rule: &networkingpb.DestinationRule{Host: "*.ratings.svc.cluster.local"}},
+		{Name: "mesh", Namespace: "istio-system", Rule: &networkingpb.DestinationRule{Host: "*.local"}},
+		{Name: "external", Namespace: "foo", Rule: &networkingpb.DestinationRule{Host: "www.example.com"}},
+	}
+
+	got := ReferencedServices("istio-system", nil, policies, rbac, rules)
+	wantServices := map[string]bool{"foo/httpbin": true, "foo/sleep": true, "qux/productpage": true, "foo/reviews": true}
+	if !reflect.DeepEqual(got.Services, wantServices) {
+		t.Errorf("want services %v but got %v", wantServices, got.Services)
+	}
+	// The namespace with service level policies and the root namespace are needed for the MeshPolicy.
+	wantNamespaces := map[string]bool{"foo": true, "istio-system": true, "bar": true, "baz": true, "ratings": true}
+	if !reflect.DeepEqual(got.Namespaces, wantNamespaces) {
+		t.Errorf("want namespaces %v but got %v", wantNamespaces, got.Namespaces)
+	}
+
+	got = ReferencedServices("istio-system", nil, policies[1:], nil, nil)
+	wantNamespaces = map[string]bool{"bar": true}
+	if !reflect.DeepEqual(got.Namespaces, wantNamespaces) {
+		t.Errorf("want namespaces %v without MeshPolicy but got %v", wantNamespaces, got.Namespaces)
+	}
+	got = ReferencedServices("istio-system", &MeshConfig{AuthPolicy: "MUTUAL_TLS"}, policies[1:], nil, nil)
+	wantNamespaces = map[string]bool{"foo": true, "istio-system": true, "bar": true}
+	if !reflect.DeepEqual(got.Namespaces, wantNamespaces) {
+		t.Errorf("want namespaces %v with mesh config but got %v", wantNamespaces, got.Namespaces)
+	}
+}
+
+func TestReferencedServices_MeshPolicyJWT(t *testing.T) {
+	policies := []*InputPolicy{
+		inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: MeshPolicy
+metadata:
+  name: default
+spec:
+  origins:
+  - jwt:
+      issuer: iss-mesh
+  principalBinding: USE_ORIGIN
+`),
+		inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: foo
+spec:
+  targets:
+  - name: httpbin
+  peers:
+  - mtls: {}
+`),
+	}
+	all := []corev1.Service{
+		{ObjectMeta: metav1.ObjectMeta{Name: "httpbin", Namespace: "foo"}, Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "httpbin"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "sleep", Namespace: "foo"}, Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "sleep"}}},
+	}
+
+	// Only load the referenced services as in the cluster.
+	refs := ReferencedServices("istio-system", nil, policies, nil, nil)
+	svcList := &corev1.ServiceList{}
+	for _, svc := range all {
+		if refs.Namespaces[svc.Namespace] || refs.Services[svc.Namespace+"/"+svc.Name] {
+			svcList.Items = append(svcList.Items, svc)
+		}
+	}
+	mc := NewConverter("istio-system", svcList)
+	var outputs []*OutputPolicy
+	for _, policy := range policies {
+		output, result := mc.Convert(policy)
+		if len(result.Errors) != 0 {
+			t.Fatalf("want no error but got %v", result.Errors)
+		}
+		kind := "Policy"
+		if policy.Namespace == "" {
+			kind = "MeshPolicy"
+		}
+		setSource(output, "authentication.istio.io/v1alpha1", kind, policy.Namespace, policy.Name)
+		outputs = append(outputs, output...)
+	}
+	outputs, results := mc.PreservePrecedence(outputs)
+	summary := results.Summary()
+	// The expansion is reported for the mesh and for each namespace expanded to the services.
+	var expandedNamespaces []string
+	for _, issue := range summary.Errors {
+		if issue.Code == CodeJWTRequirementExpanded && strings.Contains(issue.Message, "in namespace foo") {
+			expandedNamespaces = append(expandedNamespaces, "foo")
+		}
+	}
+	if len(summary.Errors) != 2 || len(expandedNamespaces) != 1 {
+		t.Errorf("want %s errors for the mesh and namespace foo but got %v", CodeJWTRequirementExpanded, summary.Errors)
+	}
+
+	found := false
+	for _, out := range outputs {
+		if out.Authz != nil && out.Namespace == "foo" && reflect.DeepEqual(out.Authz.GetSelector().GetMatchLabels(), map[string]string{"app": "sleep"}) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("want the JWT requirement copied to service sleep in namespace foo but got %v", outputs)
+	}
+}
@@ -0,0 +1,185 @@
+package converter
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+const (
+	// maxRegexPaths is the maximum number of paths translated from a single regex.
+	maxRegexPaths = 32
+	// maxRegexClassSize is the maximum number of characters in a character class expanded to the alternation.
+	maxRegexClassSize = 16
+)
+
+// regexPart is a part of the regex translated to the literal, optionally preceded and followed by any string (.*).
+type regexPart struct {
+	literal  string
+	leadAny  bool
+	trailAny bool
+}
+
+func (p regexPart) any() bool {
+	return p.literal == "" && (p.leadAny || p.trailAny)
+}
+
+// regexPaths translates the trigger rule regex to the exact, prefix (ending with *) or suffix (starting with *) paths in
+// beta. The regex in alpha must match the whole path, it is translated only if the paths match exactly the same set of
+// paths, otherwise it returns an error reporting the regex construct that blocked the translation.
+//
+// The supported regex includes literals, the alternation (|), the optional (?), small character classes, groups, the
+// any string (.*) at the beginning or the end and the anchors (^ and $) at the beginning or the end.
+func regexPaths(regex string) ([]string, error) {
+	re, err := syntax.Parse(regex, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	}
+	parts, err := translateRegex(re.Simplify(), true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for _, part := range parts {
+		switch {
+		case strings.Contains(part.literal, "*"):
+			// The * in beta is always the wildcard of the prefix or suffix match, it could not match the literal *.
+			return nil, fmt.Errorf("the path containing the literal * could not be represented in beta policy")
+		case part.any():
+			// Any path matches, the other paths are redundant.
+			return []string{"*"}, nil
+		case part.leadAny && part.trailAny:
+			return nil, fmt.Errorf("the path containing %q could not be represented in beta policy", part.literal)
+		case part.leadAny:
+			ret = append(ret, "*"+part.literal)
+		case part.trailAny:
+			ret = append(ret, part.literal+"*")
+		case part.literal == "":
+			return nil, fmt.Errorf("the empty path could not be represented in beta policy")
+		default:
+			ret = append(ret, part.literal)
+		}
+	}
+	return uniqueStrings(ret), nil
+}
+
+// translateRegex translates the regex to the parts, atStart and atEnd tell whether the regex is at the beginning or the
+// end of the whole regex where the anchors are allowed.
+func translateRegex(re *syntax.Regexp, atStart, atEnd bool) ([]regexPart, error) {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return []regexPart{{}}, nil
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil, fmt.Errorf("the case-insensitive match %q is not supported", re.String())
+		}
+		return []regexPart{{literal: string(re.Rune)}}, nil
+	case syntax.OpCharClass:
+		size := 0
+		for i := 0; i < len(re.Rune); i += 2 {
+			size += int(re.Rune[i+1]-re.Rune[i]) + 1
+		}
+		if size > maxRegexClassSize {
+			return nil, fmt.Errorf("the character class %s matching more than %d characters is not supported", re.String(), maxRegexClassSize)
+		}
+		var ret []regexPart
+		for i := 0; i < len(re.Rune); i += 2 {
+			for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+				ret = append(ret, regexPart{literal: string(r)})
+			}
+		}
+		return ret, nil
+	case syntax.OpBeginLine, syntax.OpBeginText:
+		if !atStart {
+			return nil, fmt.Errorf("the anchor ^ not at the beginning is not supported")
+		}
+		return []regexPart{{}}, nil
+	case syntax.OpEndLine, syntax.OpEndText:
+		if !atEnd {
+			return nil, fmt.Errorf("the anchor $ not at the end is not supported")
+		}
+		return []regexPart{{}}, nil
+	case syntax.OpCapture:
+		return translateRegex(re.Sub[0], atStart, atEnd)
+	case syntax.OpStar:
+		// The path never includes the new line, so .* with or without the s flag matches any path.
+		if sub := re.Sub[0]; sub.Op == syntax.OpAnyChar || sub.Op == syntax.OpAnyCharNotNL {
+			return []regexPart{{leadAny: true, trailAny: true}}, nil
+		}
+		return nil, fmt.Errorf("the repetition %s is not supported", re.String())
+	case syntax.OpQuest:
+		sub, err := translateRegex(re.Sub[0], atStart, atEnd)
+		if err != nil {
+			return nil, err
+		}
+		return limitRegexParts(append([]regexPart{{}}, sub...))
+	case syntax.OpAlternate:
+		var ret []regexPart
+		for _, sub := range re.Sub {
+			parts, err := translateRegex(sub, atStart, atEnd)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, parts...)
+		}
+		return limitRegexParts(ret)
+	case syntax.OpConcat:
+		ret := []regexPart{{}}
+		for i, sub := range re.Sub {
+			parts, err := translateRegex(sub, atStart && i == 0, atEnd && i == len(re.Sub)-1)
+			if err != nil {
+				return nil, err
+			}
+			var next []regexPart
+			for _, a := range ret {
+				for _, b := range parts {
+					part, err := concatRegexParts(a, b)
+					if err != nil {
+						return nil, fmt.Errorf("%v in %s", err, re.String())
+					}
+					next = append(next, part)
+				}
+			}
+			if ret, err = limitRegexParts(next); err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	case syntax.OpPlus, syntax.OpRepeat:
+		return nil, fmt.Errorf("the repetition %s is not supported", re.String())
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return nil, fmt.Errorf("the single character wildcard . is not supported")
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return nil, fmt.Errorf("the word boundary %s is not supported", re.String())
+	case syntax.OpNoMatch:
+		return nil, fmt.Errorf("the regex never matching any path is not supported")
+	}
+	return nil, fmt.Errorf("the regex %s is not supported", re.String())
+}
+
+// concatRegexParts concatenates the two parts, the any string (.*) is only supported at the beginning or the end.
+func concatRegexParts(a, b regexPart) (regexPart, error) {
+	switch {
+	case a == regexPart{}:
+		return b, nil
+	case b == regexPart{}:
+		return a, nil
+	case a.any() && b.any():
+		return regexPart{leadAny: true, trailAny: true}, nil
+	case a.any():
+		return regexPart{literal: b.literal, leadAny: true, trailAny: b.trailAny}, nil
+	case b.any():
+		return regexPart{literal: a.literal, leadAny: a.leadAny, trailAny: true}, nil
+	case a.trailAny || b.leadAny:
+		return regexPart{}, fmt.Errorf("the any string .* in the middle is not supported")
+	}
+	return regexPart{literal: a.literal + b.literal, leadAny: a.leadAny, trailAny: b.trailAny}, nil
+}
+
+func limitRegexParts(parts []regexPart) ([]regexPart, error) {
+	if len(parts) > maxRegexPaths {
+		return nil, fmt.Errorf("the regex expands to more than %d paths", maxRegexPaths)
+	}
+	return parts, nil
+}
@@ -0,0 +1,56 @@
+package converter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegexPaths(t *testing.T) {
+	cases := []struct {
+		regex     string
+		want      []string
+		wantError string
+	}{
+		{regex: "/health", want: []string{"/health"}},
+		{regex: "^/health$", want: []string{"/health"}},
+		{regex: "/health|/ready", want: []string{"/health", "/ready"}},
+		{regex: "^(/health|/ready)$", want: []string{"/health", "/ready"}},
+		{regex: "/api/v[12]/users", want: []string{"/api/v1/users", "/api/v2/users"}},
+		{regex: "/api/.*", want: []string{"/api/*"}},
+		{regex: "^/api/(v1|v2)/.*$", want: []string{"/api/v1/*", "/api/v2/*"}},
+		{regex: ".*\\.json", want: []string{"*.json"}},
+		{regex: "/status/?", want: []string{"/status", "/status/"}},
+		{regex: ".*", want: []string{"*"}},
+		{regex: "/api/.*|.*", want: []string{"*"}},
+		{regex: "/api/v[0-9]+/.*", wantError: "the repetition [0-9]+ is not supported"},
+		{regex: "/api/[a-z]/.*", wantError: "the character class [a-z] matching more than 16 characters is not supported"},
+		{regex: "/api/.*/users", wantError: "the any string .* in the middle is not supported"},
+		{regex: ".*admin.*", wantError: "the path containing \"admin\" could not be represented in beta policy"},
+		{regex: "^/a\\*$", wantError: "the path containing the literal * could not be represented in beta policy"},
+		{regex: "/a/\\*/b", wantError: "the path containing the literal * could not be represented in beta policy"},
+		{regex: "/a.c", wantError: "the single character wildcard . is not supported"},
+		{regex: "(?i)/health", wantError: "the case-insensitive match"},
+		{regex: "/health\\b", wantError: "the word boundary \\b is not supported"},
+		{regex: "/api/^v1", wantError: "the anchor ^ not at the beginning is not supported"},
+		{regex: "/api/(", wantError: "invalid regex"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.regex, func(t *testing.T) {
+			got, err := regexPaths(tc.regex)
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("want error %q but got %v (%v)", tc.wantError, err, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want no error but got %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package converter
+
+import "sort"
+
+// IssueCode identifies the kind of issue found in the conversion. The codes are stable and could be used to match
+// or suppress specific issues, do not change the value of existing codes.
+type IssueCode string
+
+// Codes of the issues found in the conversion.
+const (
+	// Authentication policy.
+	CodeDuplicateTarget         IssueCode = "DUPLICATE_TARGET"
+	CodeServiceNotFound         IssueCode = "SERVICE_NOT_FOUND"
+	CodePortNotFound            IssueCode = "PORT_NOT_FOUND"
+	CodeTargetPortUnresolved    IssueCode = "TARGET_PORT_UNRESOLVED"
+	CodeTargetPortInconsistent  IssueCode = "TARGET_PORT_INCONSISTENT"
+	CodeTriggerMultipleIssuers  IssueCode = "TRIGGER_MULTIPLE_ISSUERS"
+	CodeTriggerRegexUnsupported IssueCode = "TRIGGER_REGEX_UNSUPPORTED"
+	CodeJWTPeerUnsupported      IssueCode = "JWT_PEER_UNSUPPORTED"
+	CodePeerMethodEmpty         IssueCode = "PEER_METHOD_EMPTY"
+	CodePeerMethodIgnored       IssueCode = "PEER_METHOD_IGNORED"
+	CodeAllowTLSUnsupported     IssueCode = "ALLOW_TLS_UNSUPPORTED"
+	CodeMTLSModeUnsupported     IssueCode = "MTLS_MODE_UNSUPPORTED"
+	CodePeerIsOptional          IssueCode = "PEER_IS_OPTIONAL"
+
+	// Generated PeerAuthentication.
+	CodePeerAuthenticationConflict IssueCode = "PEER_AUTHENTICATION_CONFLICT"
+	CodePeerAuthenticationMerged   IssueCode = "PEER_AUTHENTICATION_MERGED"
+
+	// Precedence of the alpha authentication policies.
+	CodeJWTRequirementExpanded IssueCode = "JWT_REQUIREMENT_EXPANDED"
+	CodeJWTIssuerInherited     IssueCode = "JWT_ISSUER_INHERITED"
+	CodeRootNamespacePolicy    IssueCode = "ROOT_NAMESPACE_POLICY"
+
+	// DestinationRule.
+	CodeDestinationRuleConflict  IssueCode = "DESTINATION_RULE_CONFLICT"
+	CodeDestinationRuleRedundant IssueCode = "DESTINATION_RULE_REDUNDANT"
+
+	// MeshConfig.
+	CodeMeshConfigConflict IssueCode = "MESH_CONFIG_CONFLICT"
+	CodeAutoMTLSDisabled   IssueCode = "AUTO_MTLS_DISABLED"
+
+	// EnvoyFilter generated to preserve the 401 response.
+	CodeEnvoyFilterGenerated IssueCode = "ENVOY_FILTER_GENERATED"
+
+	// targetRefs generated with the v1 output API version.
+	CodeTargetRefGenerated IssueCode = "TARGET_REF_GENERATED"
+
+	// RBAC policy.
+	CodeRbacConfigNotFound        IssueCode = "RBAC_CONFIG_NOT_FOUND"
+	CodeRbacConfigDuplicate       IssueCode = "RBAC_CONFIG_DUPLICATE"
+	CodeRbacModeUnsupported       IssueCode = "RBAC_MODE_UNSUPPORTED"
+	CodeEnforcementPermissive     IssueCode = "ENFORCEMENT_MODE_PERMISSIVE"
+	CodeInvalidServiceName        IssueCode = "INVALID_SERVICE_NAME"
+	CodeSubjectNotFound           IssueCode = "SUBJECT_NOT_FOUND"
+	CodeRoleRefUnsupported        IssueCode = "ROLE_REF_UNSUPPORTED"
+	CodeRoleNotFound              IssueCode = "ROLE_NOT_FOUND"
+	CodeConstraintUnsupported     IssueCode = "CONSTRAINT_UNSUPPORTED"
+	CodePropertyUnsupported       IssueCode = "PROPERTY_UNSUPPORTED"
+	CodePrincipalBindingPartial   IssueCode = "PRINCIPAL_BINDING_PARTIAL"
+	CodePrincipalBindingNamespace IssueCode = "PRINCIPAL_BINDING_NAMESPACE"
+
+	// Tool usage.
+	CodeInvalidSuppression IssueCode = "INVALID_SUPPRESSION"
+)
+
+// IssueCodes includes all the known issue codes.
+var IssueCodes = []IssueCode{
+	CodeDuplicateTarget,
+	CodeServiceNotFound,
+	CodePortNotFound,
+	CodeTargetPortUnresolved,
+	CodeTargetPortInconsistent,
+	CodeTriggerMultipleIssuers,
+	CodeTriggerRegexUnsupported,
+	CodeJWTPeerUnsupported,
+	CodePeerMethodEmpty,
+	CodePeerMethodIgnored,
+	CodeAllowTLSUnsupported,
+	CodeMTLSModeUnsupported,
+	CodePeerIsOptional,
+	CodePeerAuthenticationConflict,
+	CodePeerAuthenticationMerged,
+	CodeJWTRequirementExpanded,
+	CodeJWTIssuerInherited,
+	CodeRootNamespacePolicy,
+	CodeDestinationRuleConflict,
+	CodeDestinationRuleRedundant,
+	CodeMeshConfigConflict,
+	CodeAutoMTLSDisabled,
+	CodeEnvoyFilterGenerated,
+	CodeTargetRefGenerated,
+	CodeRbacConfigNotFound,
+	CodeRbacConfigDuplicate,
+	CodeRbacModeUnsupported,
+	CodeEnforcementPermissive,
+	CodeInvalidServiceName,
+	CodeSubjectNotFound,
+	CodeRoleRefUnsupported,
+	CodeRoleNotFound,
+	CodeConstraintUnsupported,
+	CodePropertyUnsupported,
+	CodePrincipalBindingPartial,
+	CodePrincipalBindingNamespace,
+	CodeInvalidSuppression,
+}
+
+// IsKnownIssueCode returns true if the code is one of the known issue codes.
+func IsKnownIssueCode(code IssueCode) bool {
+	for _, c := range IssueCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Severity of the issue, an error fails the conversion while a warning does not.
+type Severity string
+
+// Error and Warning for the severity.
+const (
+	SeverityError   Severity = "ERROR"
+	SeverityWarning Severity = "WARNING"
+)
+
+// Issue is a problem found in the conversion of a single alpha policy.
+type Issue struct {
+	Code     IssueCode `json:"code"`
+	Severity Severity  `json:"severity"`
+	// Field is the path of the field in the alpha policy that caused the issue, e.g. spec.targets[0].ports[1].
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i *Issue) String() string {
+	return i.Message
+}
+
+// ResultSummary includes the conversion summary.
+type ResultSummary struct {
+	Errors   []*Issue
+	Warnings []*Issue
+	// Suppressed includes the errors and warnings that are suppressed explicitly by the user.
+	Suppressed []*Issue
+}
+
+func (r *ResultSummary) addError(code IssueCode, field, msg string) {
+	r.Errors = append(r.Errors, &Issue{Code: code, Severity: SeverityError, Field: field, Message: msg})
+}
+
+func (r *ResultSummary) addWarning(code IssueCode, field, msg string) {
+	r.Warnings = append(r.Warnings, &Issue{Code: code, Severity: SeverityWarning, Field: field, Message: msg})
+}
+
+// SourceResults includes the issues found in the passes over the beta policies converted from all alpha policies (e.g.
+// the precedence), keyed by the alpha policy that caused each issue so that it could be suppressed per policy.
+type SourceResults map[ObjectReference]*ResultSummary
+
+// of returns the summary of the alpha policy, it is created if not exists.
+func (r SourceResults) of(source ObjectReference) *ResultSummary {
+	if r[source] == nil {
+		r[source] = &ResultSummary{}
+	}
+	return r[source]
+}
+
+// Sources returns the alpha policies with issues sorted by kind, namespace and name.
+func (r SourceResults) Sources() []ObjectReference {
+	var ret []ObjectReference
+	for source := range r {
+		ret = append(ret, source)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].String() < ret[j].String() })
+	return ret
+}
+
+// Summary returns the issues of all alpha policies in the order of Sources.
+func (r SourceResults) Summary() *ResultSummary {
+	ret := &ResultSummary{}
+	for _, source := range r.Sources() {
+		ret.Errors = append(ret.Errors, r[source].Errors...)
+		ret.Warnings = append(ret.Warnings, r[source].Warnings...)
+		ret.Suppressed = append(ret.Suppressed, r[source].Suppressed...)
+	}
+	return ret
+}
+
+// Suppress moves the errors and warnings with the given codes to the suppressed issues, the suppressed errors no
+// longer fail the conversion.
+func (r *ResultSummary) Suppress(codes map[IssueCode]bool) {
+	if len(codes) == 0 {
+		return
+	}
+	filter := func(issues []*Issue) []*Issue {
+		var ret []*Issue
+		for _, issue := range issues {
+			if codes[issue.Code] {
+				r.Suppressed = append(r.Suppressed, issue)
+			} else {
+				ret = append(ret, issue)
+			}
+		}
+		return ret
+	}
+	r.Errors = filter(r.Errors)
+	r.Warnings = filter(r.Warnings)
+}
@@ -0,0 +1,24 @@
+package converter
+
+// DryRunAnnotation makes Istio evaluate the AuthorizationPolicy without enforcing it, the result is only recorded in the
+// logs and metrics of the proxy (shadow_effective_policy_id and shadow_engine_result).
+const DryRunAnnotation = "istio.io/dry-run"
+
+// DryRunComment is appended to the convert annotation of the AuthorizationPolicy in dry-run mode, it is removed when
+// the AuthorizationPolicy is promoted.
+const DryRunComment = ", in dry-run mode until promoted"
+
+// ShadowJWTRequirements sets the dry-run mode on each DENY AuthorizationPolicy requiring JWT so that the requests it
+// would deny are only logged, it returns the outputs changed. The JWT is still validated by the RequestAuthentication,
+// only the request without JWT is no longer rejected until the AuthorizationPolicy is promoted.
+func ShadowJWTRequirements(outputs []*OutputPolicy) []*OutputPolicy {
+	var ret []*OutputPolicy
+	for _, output := range outputs {
+		if !requiresJWTAuthz(output) {
+			continue
+		}
+		output.DryRun = true
+		ret = append(ret, output)
+	}
+	return ret
+}
@@ -0,0 +1,48 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShadowJWTRequirements(t *testing.T) {
+	mc := NewConverter("istio-system", nil)
+	outputs, result := mc.Convert(inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+spec:
+  peers:
+  - mtls: {}
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+  principalBinding: USE_ORIGIN
+`))
+	if len(result.Errors) != 0 {
+		t.Fatalf("want no error but got %v", result.Errors)
+	}
+	for _, out := range outputs {
+		out.Source = ObjectReference{Kind: "Policy", Namespace: "foo", Name: "default"}
+	}
+
+	shadowed := ShadowJWTRequirements(outputs)
+	if len(shadowed) != 1 || shadowed[0].Authz == nil {
+		t.Fatalf("want 1 AuthorizationPolicy in dry-run mode but got %v", shadowed)
+	}
+	for _, out := range outputs {
+		for _, obj := range out.ToObjects() {
+			got := obj.Annotations[DryRunAnnotation]
+			if want := map[bool]string{true: "true"}[obj.Kind == AuthorizationPolicyGVK.Kind]; got != want {
+				t.Errorf("%s %s: want dry-run annotation %q but got %q", obj.Kind, obj.Name, want, got)
+			}
+			gotComment := strings.HasSuffix(obj.Annotations[ConvertAnnotation], DryRunComment)
+			if want := obj.Kind == AuthorizationPolicyGVK.Kind; gotComment != want {
+				t.Errorf("%s %s: want dry-run comment %v but got %q", obj.Kind, obj.Name, want, obj.Annotations[ConvertAnnotation])
+			}
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	authnpb "istio.io/api/authentication/v1alpha1"
+	betapb "istio.io/api/security/v1beta1"
+)
+
+// issuerClaimKey is the condition key of the issuer claim in the JWT.
+const issuerClaimKey = "request.auth.claims[iss]"
+
+// pathOperation is a path condition in the AuthorizationPolicy, the nil paths means all paths.
+type pathOperation struct {
+	paths    []string
+	notPaths []string
+}
+
+func (op *pathOperation) all() bool {
+	return op.paths == nil && len(op.notPaths) == 0
+}
+
+func (op *pathOperation) key() string {
+	return fmt.Sprintf("%v/%v", op.paths, op.notPaths)
+}
+
+// triggerPaths converts the StringMatch in the trigger rule to the paths in beta, it returns nil if any of them is not
+// supported (i.e. regex that could not be translated).
+func triggerPaths(matches []*authnpb.StringMatch) []string {
+	if len(matches) == 0 {
+		return nil
+	}
+	var ret []string
+	for _, path := range matches {
+		if path.GetExact() != "" {
+			ret = append(ret, path.GetExact())
+		} else if path.GetPrefix() != "" {
+			ret = append(ret, path.GetPrefix()+"*")
+		} else if path.GetSuffix() != "" {
+			ret = append(ret, "*"+path.GetSuffix())
+		} else if paths, err := regexPaths(path.GetRegex()); path.GetRegex() != "" && err == nil {
+			ret = append(ret, paths...)
+		} else {
+			return nil
+		}
+	}
+	return uniqueStrings(ret)
+}
+
+// hasTriggerRules returns true if any JWT origin has trigger rules.
+func hasTriggerRules(origins []*authnpb.OriginAuthenticationMethod) bool {
+	for _, origin := range origins {
+		if len(origin.GetJwt().GetTriggerRules()) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// triggeredOperations returns the paths that trigger the JWT authentication, each trigger rule is a separate operation
+// and no trigger rule means all paths.
+func triggeredOperations(rules []*authnpb.Jwt_TriggerRule) []*pathOperation {
+	if len(rules) == 0 {
+		return []*pathOperation{{}}
+	}
+	var ret []*pathOperation
+	for _, rule := range rules {
+		ret = append(ret, &pathOperation{paths: triggerPaths(rule.IncludedPaths), notPaths: triggerPaths(rule.ExcludedPaths)})
+	}
+	return ret
+}
+
+// notTriggeredOperations returns the paths that do not trigger the JWT authentication. A path is not triggered if it is
+// either not included or excluded by every trigger rule.
+func notTriggeredOperations(rules []*authnpb.Jwt_TriggerRule) ([]*pathOperation, error) {
+	ret := []*pathOperation{{}}
+	for _, op := range triggeredOperations(rules) {
+		var not []*pathOperation
+		if op.paths != nil {
+			not = append(not, &pathOperation{notPaths: op.paths})
+		}
+		if len(op.notPaths) != 0 {
+			not = append(not, &pathOperation{paths: op.notPaths})
+		}
+		var err error
+		if ret, err = intersectOperations(ret, not); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// intersectOperations returns the paths matching any operation in a and any operation in b.
+func intersectOperations(a, b []*pathOperation) ([]*pathOperation, error) {
+	var ret []*pathOperation
+	found := map[string]bool{}
+	for _, x := range a {
+		for _, y := range b {
+			paths, err := intersectPaths(x.paths, y.paths)
+			if err != nil {
+				return nil, err
+			}
+			notPaths := uniqueStrings(append(append([]string{}, x.notPaths...), y.notPaths...))
+			if paths != nil {
+				// Remove the paths always excluded by the notPaths, the operation never matches if no path is left.
+				if paths = excludePaths(paths, notPaths); len(paths) == 0 {
+					continue
+				}
+			}
+			op := &pathOperation{paths: paths, notPaths: notPaths}
+			if !found[op.key()] {
+				found[op.key()] = true
+				ret = append(ret, op)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// intersectPaths returns the paths matching any path in a and any path in b, nil means all paths and the empty slice
+// means no path.
+func intersectPaths(a, b []string) ([]string, error) {
+	switch {
+	case a == nil:
+		return b, nil
+	case b == nil:
+		return a, nil
+	}
+	ret := []string{}
+	for _, x := range a {
+		for _, y := range b {
+			path, ok, err := intersectPath(x, y)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				ret = append(ret, path)
+			}
+		}
+	}
+	if len(ret) == 0 {
+		return ret, nil
+	}
+	return uniqueStrings(ret), nil
+}
+
+// excludePaths returns the paths that are not fully covered by any of the notPaths.
+func excludePaths(paths, notPaths []string) []string {
+	ret := []string{}
+	for _, path := range paths {
+		excluded := false
+		for _, notPath := range notPaths {
+			if covered, ok, err := intersectPath(path, notPath); err == nil && ok && covered == path {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			ret = append(ret, path)
+		}
+	}
+	return ret
+}
+
+// intersectPath returns the path matching both the exact, prefix (ending with *) or suffix (starting with *) paths.
+func intersectPath(a, b string) (string, bool, error) {
+	isPrefix := func(p string) bool { return strings.HasSuffix(p, "*") }
+	isSuffix := func(p string) bool { return strings.HasPrefix(p, "*") }
+	switch {
+	case !isPrefix(a) && !isSuffix(a):
+		return a, betaMatchAny([]string{b}, a), nil
+	case !isPrefix(b) && !isSuffix(b):
+		return b, betaMatchAny([]string{a}, b), nil
+	case isPrefix(a) && isPrefix(b):
+		if strings.HasPrefix(a[:len(a)-1], b[:len(b)-1]) {
+			return a, true, nil
+		}
+		return b, strings.HasPrefix(b[:len(b)-1], a[:len(a)-1]), nil
+	case isSuffix(a) && isSuffix(b):
+		if strings.HasSuffix(a[1:], b[1:]) {
+			return a, true, nil
+		}
+		return b, strings.HasSuffix(b[1:], a[1:]), nil
+	}
+	return "", false, fmt.Errorf("the paths matching both %s and %s could not be represented in beta policy", a, b)
+}
+
+// convertTriggerRules converts the trigger rules of multiple JWT issuers to the rules of the DENY AuthorizationPolicy.
+// In alpha, a request is rejected if its path triggers any issuer but it has no valid JWT from the triggered issuers.
+// This is converted to a rule denying the request without JWT on the paths triggering any issuer, and for each issuer
+// with trigger rules, a rule denying the request with the JWT of the issuer (by the iss claim) on the paths that trigger
+// other issuers but not this one.
+func convertTriggerRules(origins []*authnpb.OriginAuthenticationMethod, ports []uint32) ([]*betapb.Rule, error) {
+	var issuers []string
+	triggers := map[string][]*authnpb.Jwt_TriggerRule{}
+	always := map[string]bool{}
+	for _, origin := range origins {
+		jwt := origin.GetJwt()
+		if jwt == nil {
+			continue
+		}
+		if _, found := triggers[jwt.Issuer]; !found && !always[jwt.Issuer] {
+			issuers = append(issuers, jwt.Issuer)
+		}
+		// The issuer is always triggered if any of its origins has no trigger rule.
+		if len(jwt.TriggerRules) == 0 {
+			always[jwt.Issuer] = true
+		}
+		triggers[jwt.Issuer] = append(triggers[jwt.Issuer], jwt.TriggerRules...)
+	}
+	triggered := func(issuer string) []*pathOperation {
+		if always[issuer] {
+			return []*pathOperation{{}}
+		}
+		return triggeredOperations(triggers[issuer])
+	}
+
+	var anyTriggered []*pathOperation
+	for _, issuer := range issuers {
+		anyTriggered = append(anyTriggered, triggered(issuer)...)
+	}
+	rules := []*betapb.Rule{{
+		From: []*betapb.Rule_From{{Source: &betapb.Source{NotRequestPrincipals: []string{"*"}}}},
+		To:   toOperations(anyTriggered, ports),
+	}}
+
+	for _, issuer := range issuers {
+		if always[issuer] {
+			continue
+		}
+		notTriggered, err := notTriggeredOperations(triggers[issuer])
+		if err != nil {
+			return nil, fmt.Errorf("issuer %s: %v", issuer, err)
+		}
+		var others []*pathOperation
+		for _, other := range issuers {
+			if other != issuer {
+				others = append(others, triggered(other)...)
+			}
+		}
+		ops, err := intersectOperations(others, notTriggered)
+		if err != nil {
+			return nil, fmt.Errorf("issuer %s: %v", issuer, err)
+		}
+		if len(ops) == 0 {
+			continue
+		}
+		rules = append(rules, &betapb.Rule{
+			To:   toOperations(ops, ports),
+			When: []*betapb.Condition{{Key: issuerClaimKey, Values: []string{issuer}}},
+		})
+	}
+	return rules, nil
+}
+
+// toOperations converts the path operations to the operations of the rule, nil means all paths and ports.
+func toOperations(ops []*pathOperation, ports []uint32) []*betapb.Rule_To {
+	var ret []*betapb.Rule_To
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].all() && !ops[j].all() })
+	for _, op := range ops {
+		if op.all() {
+			// Any other operation is covered by the one matching all paths.
+			if len(ports) == 0 {
+				return nil
+			}
+			return []*betapb.Rule_To{{Operation: &betapb.Operation{Ports: toStr(ports)}}}
+		}
+		ret = append(ret, &betapb.Rule_To{Operation: &betapb.Operation{Paths: op.paths, NotPaths: op.notPaths, Ports: toStr(ports)}})
+	}
+	return ret
+}
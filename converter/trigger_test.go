@@ -0,0 +1,35 @@
+package converter
+
+import (
+	"testing"
+)
+
+func TestIntersectPath(t *testing.T) {
+	cases := []struct {
+		a, b    string
+		want    string
+		wantOK  bool
+		wantErr bool
+	}{
+		{a: "/foo", b: "/foo", want: "/foo", wantOK: true},
+		{a: "/foo", b: "/bar", wantOK: false},
+		{a: "/foo/bar", b: "/foo*", want: "/foo/bar", wantOK: true},
+		{a: "*.json", b: "/data.json", want: "/data.json", wantOK: true},
+		{a: "/foo*", b: "/foo/bar*", want: "/foo/bar*", wantOK: true},
+		{a: "/foo*", b: "/bar*", wantOK: false},
+		{a: "*.json", b: "*/data.json", want: "*/data.json", wantOK: true},
+		{a: "/foo*", b: "*.json", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.a+"&"+tc.b, func(t *testing.T) {
+			got, ok, err := intersectPath(tc.a, tc.b)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("want error %v but got %v", tc.wantErr, err)
+			}
+			if ok != tc.wantOK || (ok && got != tc.want) {
+				t.Errorf("want %q (%v) but got %q (%v)", tc.want, tc.wantOK, got, ok)
+			}
+		})
+	}
+}
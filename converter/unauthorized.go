@@ -0,0 +1,250 @@
+package converter
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/types"
+	networkingpb "istio.io/api/networking/v1alpha3"
+	betapb "istio.io/api/security/v1beta1"
+)
+
+// unauthorizedLua restores the alpha response (401 "Origin authentication failed.") for the request without JWT that is
+// denied by the AuthorizationPolicy requiring JWT (403 "RBAC: access denied"). The filter is inserted before the RBAC
+// filter so that it sees the result of the JWT authentication on the request and the local reply of the RBAC filter on
+// the response. Only the request denied by one of the given policies (identified by the policy ID in the dynamic
+// metadata of the RBAC filter) is changed, the denial of any other policy is kept. It requires the Envoy Lua body
+// setBytes API, which is available since Istio 1.8. The %s is replaced with the policy ID prefixes.
+const unauthorizedLua = `local policies = {%s}
+
+function envoy_on_request(request_handle)
+  local authn = request_handle:streamInfo():dynamicMetadata():get("istio_authn")
+  if authn == nil or authn["request.auth.principal"] == nil then
+    request_handle:streamInfo():dynamicMetadata():set("envoy.filters.http.lua", "request.auth.missing", true)
+  end
+end
+
+local function denied_by_policies(response_handle)
+  local rbac = response_handle:streamInfo():dynamicMetadata():get("envoy.filters.http.rbac")
+  local id = rbac and rbac["enforced_effective_policy_id"]
+  if id == nil then
+    return false
+  end
+  for _, prefix in ipairs(policies) do
+    if string.sub(id, 1, string.len(prefix)) == prefix then
+      return true
+    end
+  end
+  return false
+end
+
+function envoy_on_response(response_handle)
+  local metadata = response_handle:streamInfo():dynamicMetadata():get("envoy.filters.http.lua")
+  if metadata == nil or not metadata["request.auth.missing"] or response_handle:headers():get(":status") ~= "403" then
+    return
+  end
+  if not denied_by_policies(response_handle) then
+    return
+  end
+  local body = response_handle:body()
+  if body == nil or body:getBytes(0, body:length()) ~= "RBAC: access denied" then
+    return
+  end
+  response_handle:headers():replace(":status", "401")
+  body:setBytes("Origin authentication failed.")
+end
+`
+
+// unauthorizedFilterSuffix is appended to the name of the AuthorizationPolicy to name the EnvoyFilter.
+const unauthorizedFilterSuffix = "-401"
+
+// PreserveUnauthorized generates an EnvoyFilter for the workloads selected by each DENY AuthorizationPolicy that
+// requires JWT, so that the request without JWT is rejected with 401 as in alpha instead of 403 in beta. The workloads
+// touched by each EnvoyFilter are reported in a warning attributed to the alpha policy of the AuthorizationPolicy.
+func (mc *Converter) PreserveUnauthorized(outputs []*OutputPolicy) ([]*OutputPolicy, SourceResults) {
+	results := SourceResults{}
+	var ret []*OutputPolicy
+	found := map[string]*OutputPolicy{}
+	policies := map[*OutputPolicy][]string{}
+	for _, output := range outputs {
+		if !requiresJWTAuthz(output) {
+			continue
+		}
+		labels := output.Authz.GetSelector().GetMatchLabels()
+		key := output.Namespace + "/" + labelsToString(labels)
+		if filter, ok := found[key]; ok {
+			// The workloads are already selected by another EnvoyFilter, only the ports and the policy are merged.
+			mergePatches(filter.EnvoyFilter, unauthorizedPatches(authzPorts(output.Authz), nil))
+			policies[filter] = append(policies[filter], policyIDPrefix(output))
+			continue
+		}
+
+		filter := &networkingpb.EnvoyFilter{ConfigPatches: unauthorizedPatches(authzPorts(output.Authz), nil)}
+		if len(labels) != 0 {
+			filter.WorkloadSelector = &networkingpb.WorkloadSelector{Labels: labels}
+		}
+		workloads := mc.workloadsSelected(output.Namespace, labels)
+		out := &OutputPolicy{
+			Name:      output.Name + unauthorizedFilterSuffix,
+			Namespace: output.Namespace,
+			Comment: fmt.Sprintf("returns 401 for the request without JWT denied by AuthorizationPolicy %s/%s on %s",
+				output.Namespace, output.Name, workloads),
+			Source:      output.Source,
+			EnvoyFilter: filter,
+		}
+		found[key] = out
+		policies[out] = []string{policyIDPrefix(output)}
+		ret = append(ret, out)
+		results.of(output.Source).addWarning(CodeEnvoyFilterGenerated, "", fmt.Sprintf("EnvoyFilter %s/%s changes the status of the request "+
+			"without JWT denied by the AuthorizationPolicy from 403 to 401 on %s", out.Namespace, out.Name, workloads))
+	}
+	// The Lua filter is generated once all the policies denying the request on the workloads are known.
+	for _, out := range ret {
+		value := unauthorizedFilterValue(policies[out])
+		for _, patch := range out.EnvoyFilter.ConfigPatches {
+			patch.Patch.Value = value
+		}
+	}
+	return ret, results
+}
+
+// policyIDPrefix returns the prefix of the policy ID set by the RBAC filter in the dynamic metadata when the request is
+// denied by a rule of the AuthorizationPolicy.
+func policyIDPrefix(output *OutputPolicy) string {
+	return fmt.Sprintf("ns[%s]-policy[%s]-rule[", output.Namespace, output.Name)
+}
+
+// requiresJWTAuthz returns true if the output is a DENY AuthorizationPolicy requiring JWT converted from the alpha
+// authentication policy, the AuthorizationPolicy in dry-run mode denies nothing and is skipped.
+func requiresJWTAuthz(output *OutputPolicy) bool {
+	if output.Authz == nil || output.DryRun || output.Authz.Action != betapb.AuthorizationPolicy_DENY ||
+		(output.Source.Kind != "Policy" && output.Source.Kind != "MeshPolicy") {
+		return false
+	}
+	for _, rule := range output.Authz.Rules {
+		for _, from := range rule.From {
+			if len(from.Source.GetNotRequestPrincipals()) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authzPorts returns the ports of the AuthorizationPolicy, nil if any rule applies to all ports.
+func authzPorts(authz *betapb.AuthorizationPolicy) []uint32 {
+	found := map[uint32]bool{}
+	for _, rule := range authz.Rules {
+		if len(rule.To) == 0 {
+			return nil
+		}
+		for _, to := range rule.To {
+			if len(to.Operation.GetPorts()) == 0 {
+				return nil
+			}
+			for _, port := range to.Operation.GetPorts() {
+				if p, err := strconv.ParseUint(port, 10, 32); err == nil {
+					found[uint32(p)] = true
+				}
+			}
+		}
+	}
+	var ret []uint32
+	for port := range found {
+		ret = append(ret, port)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+// unauthorizedPatches returns the patches inserting the Lua filter before the RBAC filter on the inbound ports for the
+// request denied by the policies (the policy ID prefixes), nil ports means all ports.
+func unauthorizedPatches(ports []uint32, policies []string) []*networkingpb.EnvoyFilter_EnvoyConfigObjectPatch {
+	if len(ports) == 0 {
+		ports = []uint32{0}
+	}
+	value := unauthorizedFilterValue(policies)
+	var ret []*networkingpb.EnvoyFilter_EnvoyConfigObjectPatch
+	for _, port := range ports {
+		ret = append(ret, &networkingpb.EnvoyFilter_EnvoyConfigObjectPatch{
+			ApplyTo: networkingpb.EnvoyFilter_HTTP_FILTER,
+			Match: &networkingpb.EnvoyFilter_EnvoyConfigObjectMatch{
+				Context: networkingpb.EnvoyFilter_SIDECAR_INBOUND,
+				ObjectTypes: &networkingpb.EnvoyFilter_EnvoyConfigObjectMatch_Listener{
+					Listener: &networkingpb.EnvoyFilter_ListenerMatch{
+						PortNumber: port,
+						FilterChain: &networkingpb.EnvoyFilter_ListenerMatch_FilterChainMatch{
+							Filter: &networkingpb.EnvoyFilter_ListenerMatch_FilterMatch{
+								Name:      "envoy.filters.network.http_connection_manager",
+								SubFilter: &networkingpb.EnvoyFilter_ListenerMatch_SubFilterMatch{Name: "envoy.filters.http.rbac"},
+							},
+						},
+					},
+				},
+			},
+			Patch: &networkingpb.EnvoyFilter_Patch{
+				Operation: networkingpb.EnvoyFilter_Patch_INSERT_BEFORE,
+				Value:     value,
+			},
+		})
+	}
+	return ret
+}
+
+// unauthorizedFilterValue returns the Lua filter changing the response of the request denied by the policies.
+func unauthorizedFilterValue(policies []string) *types.Struct {
+	var quoted []string
+	for _, policy := range policies {
+		quoted = append(quoted, strconv.Quote(policy))
+	}
+	value := &types.Struct{}
+	data := fmt.Sprintf(`{"name": "envoy.filters.http.lua", "typed_config": {"@type": "type.googleapis.com/envoy.extensions.filters.http.lua.v3.Lua", "inlineCode": %s}}`,
+		strconv.Quote(fmt.Sprintf(unauthorizedLua, strings.Join(quoted, ", "))))
+	if err := jsonpb.UnmarshalString(data, value); err != nil {
+		log.Fatalf("failed to unmarshal the Lua filter: %v", err)
+	}
+	return value
+}
+
+// mergePatches adds the patches for the ports not yet patched in the EnvoyFilter, the patch on all ports covers any
+// other port.
+func mergePatches(filter *networkingpb.EnvoyFilter, patches []*networkingpb.EnvoyFilter_EnvoyConfigObjectPatch) {
+	ports := map[uint32]bool{}
+	for _, patch := range filter.ConfigPatches {
+		ports[patch.Match.GetListener().GetPortNumber()] = true
+	}
+	if ports[0] {
+		return
+	}
+	for _, patch := range patches {
+		port := patch.Match.GetListener().GetPortNumber()
+		if port == 0 {
+			filter.ConfigPatches = []*networkingpb.EnvoyFilter_EnvoyConfigObjectPatch{patch}
+			return
+		}
+		if !ports[port] {
+			ports[port] = true
+			filter.ConfigPatches = append(filter.ConfigPatches, patch)
+		}
+	}
+}
+
+// workloadsSelected describes the workloads selected by the labels in the namespace, with the names of the pods if
+// known.
+func (mc *Converter) workloadsSelected(namespace string, labels map[string]string) string {
+	if len(labels) == 0 {
+		if namespace == mc.RootNamespace {
+			return "all workloads in the mesh"
+		}
+		return fmt.Sprintf("all workloads in namespace %s", namespace)
+	}
+	ret := fmt.Sprintf("workloads with labels %s in namespace %s", labelsToString(labels), namespace)
+	if pods := mc.Service.podsSelected(namespace, labels); len(pods) != 0 {
+		ret = fmt.Sprintf("%s (pods %s)", ret, strings.Join(pods, ", "))
+	}
+	return ret
+}
@@ -0,0 +1,206 @@
+package converter
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	networkingpb "istio.io/api/networking/v1alpha3"
+	betapb "istio.io/api/security/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestConverter_PreserveUnauthorized(t *testing.T) {
+	svcList := &corev1.ServiceList{
+		Items: []corev1.Service{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "httpbin", Namespace: "foo"},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "httpbin"},
+					Ports:    []corev1.ServicePort{{Port: 8000, TargetPort: intstr.FromInt(80)}},
+				},
+			},
+		},
+	}
+	cases := []struct {
+		name          string
+		inputPolicy   *InputPolicy
+		wantName      string
+		wantNamespace string
+		wantSelector  map[string]string
+		wantPorts     []uint32
+		// wantPolicy is the ID prefix of the AuthorizationPolicy whose denial is changed to 401.
+		wantPolicy string
+		dryRun     bool
+	}{
+		{
+			name: "service-port-level",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: jwt
+  namespace: foo
+spec:
+  targets:
+  - name: httpbin
+    ports:
+    - number: 8000
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+  principalBinding: USE_ORIGIN
+`),
+			wantName:      "jwt-httpbin-401",
+			wantNamespace: "foo",
+			wantSelector:  map[string]string{"app": "httpbin"},
+			wantPorts:     []uint32{80},
+			wantPolicy:    "ns[foo]-policy[jwt-httpbin]-rule[",
+		},
+		{
+			name: "namespace-level",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: bar
+spec:
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+  principalBinding: USE_ORIGIN
+`),
+			wantName:      "default-401",
+			wantNamespace: "bar",
+			wantPorts:     []uint32{0},
+			wantPolicy:    "ns[bar]-policy[default]-rule[",
+		},
+		{
+			name: "dry-run",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: bar
+spec:
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+  principalBinding: USE_ORIGIN
+`),
+			dryRun: true,
+		},
+		{
+			name: "jwt-optional",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: bar
+spec:
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+  originIsOptional: true
+  principalBinding: USE_ORIGIN
+`),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := NewConverter("istio-system", svcList)
+			outputs, result := mc.Convert(tc.inputPolicy)
+			if len(result.Errors) != 0 {
+				t.Fatalf("want no error but got %v", result.Errors)
+			}
+			for _, out := range outputs {
+				out.Source = ObjectReference{Kind: "Policy", Namespace: tc.inputPolicy.Namespace, Name: tc.inputPolicy.Name}
+				out.DryRun = tc.dryRun
+			}
+			filters, results := mc.PreserveUnauthorized(outputs)
+			if tc.wantName == "" {
+				if len(filters) != 0 {
+					t.Errorf("want no EnvoyFilter but got %v", filters)
+				}
+				return
+			}
+			if len(filters) != 1 {
+				t.Fatalf("want 1 EnvoyFilter but got %v", filters)
+			}
+			// The warning is attributed to the alpha policy of the AuthorizationPolicy.
+			summary := results[outputs[0].Source]
+			if len(results) != 1 || summary == nil || len(summary.Warnings) != 1 || summary.Warnings[0].Code != CodeEnvoyFilterGenerated {
+				t.Fatalf("want 1 warning %s for %s but got %v", CodeEnvoyFilterGenerated, outputs[0].Source, results.Summary().Warnings)
+			}
+			got := filters[0]
+			if got.Name != tc.wantName || got.Namespace != tc.wantNamespace {
+				t.Errorf("want EnvoyFilter %s/%s but got %s/%s", tc.wantNamespace, tc.wantName, got.Namespace, got.Name)
+			}
+			if !reflect.DeepEqual(got.EnvoyFilter.GetWorkloadSelector().GetLabels(), tc.wantSelector) {
+				t.Errorf("want selector %v but got %v", tc.wantSelector, got.EnvoyFilter.GetWorkloadSelector())
+			}
+			var ports []uint32
+			for _, patch := range got.EnvoyFilter.ConfigPatches {
+				if patch.ApplyTo != networkingpb.EnvoyFilter_HTTP_FILTER || patch.Patch.Operation != networkingpb.EnvoyFilter_Patch_INSERT_BEFORE {
+					t.Errorf("want HTTP_FILTER INSERT_BEFORE patch but got %v", patch)
+				}
+				ports = append(ports, patch.Match.GetListener().GetPortNumber())
+				code := patch.Patch.Value.GetFields()["typed_config"].GetStructValue().GetFields()["inlineCode"].GetStringValue()
+				if !strings.Contains(code, strconv.Quote(tc.wantPolicy)) {
+					t.Errorf("want Lua filter for policy %s but got %s", tc.wantPolicy, code)
+				}
+			}
+			if !reflect.DeepEqual(ports, tc.wantPorts) {
+				t.Errorf("want ports %v but got %v", tc.wantPorts, ports)
+			}
+		})
+	}
+}
+
+func TestConverter_PreserveUnauthorizedMerged(t *testing.T) {
+	authz := func(name string, action betapb.AuthorizationPolicy_Action) *OutputPolicy {
+		return &OutputPolicy{
+			Name:      name,
+			Namespace: "foo",
+			Source:    ObjectReference{Kind: "Policy", Namespace: "foo", Name: name},
+			Authz: &betapb.AuthorizationPolicy{
+				Action: action,
+				Rules:  []*betapb.Rule{{From: []*betapb.Rule_From{{Source: &betapb.Source{NotRequestPrincipals: []string{"*"}}}}}},
+			},
+		}
+	}
+	outputs := []*OutputPolicy{authz("jwt-a", betapb.AuthorizationPolicy_DENY), authz("jwt-b", betapb.AuthorizationPolicy_DENY),
+		authz("allow", betapb.AuthorizationPolicy_ALLOW)}
+	filters, _ := NewConverter("istio-system", nil).PreserveUnauthorized(outputs)
+	if len(filters) != 1 {
+		t.Fatalf("want 1 EnvoyFilter but got %d", len(filters))
+	}
+	code := filters[0].EnvoyFilter.ConfigPatches[0].Patch.Value.GetFields()["typed_config"].GetStructValue().GetFields()["inlineCode"].GetStringValue()
+	want := `local policies = {"ns[foo]-policy[jwt-a]-rule[", "ns[foo]-policy[jwt-b]-rule["}`
+	if !strings.HasPrefix(code, want) {
+		t.Errorf("want Lua filter only for the DENY policies %s but got %s", want, code)
+	}
+}
+
+func TestMergePatches(t *testing.T) {
+	filter := &networkingpb.EnvoyFilter{ConfigPatches: unauthorizedPatches([]uint32{80}, nil)}
+	mergePatches(filter, unauthorizedPatches([]uint32{80, 8080}, nil))
+	if len(filter.ConfigPatches) != 2 {
+		t.Fatalf("want patches on 2 ports but got %d", len(filter.ConfigPatches))
+	}
+	mergePatches(filter, unauthorizedPatches(nil, nil))
+	if len(filter.ConfigPatches) != 1 || filter.ConfigPatches[0].Match.GetListener().GetPortNumber() != 0 {
+		t.Errorf("want a single patch on all ports but got %v", filter.ConfigPatches)
+	}
+}
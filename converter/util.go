@@ -5,7 +5,10 @@ import (
 	"fmt"
 
 	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
 	authnpb "istio.io/api/authentication/v1alpha1"
+	networkingpb "istio.io/api/networking/v1alpha3"
+	rbacpb "istio.io/api/rbac/v1alpha1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
@@ -18,25 +21,87 @@ type ObjectStruct struct {
 
 // ConvertToPolicy converts unstructured object to InputPolicy.
 func ConvertToPolicy(item unstructured.Unstructured) (*InputPolicy, error) {
+	policy := &authnpb.Policy{}
+	if err := unstructuredToProto(item, policy); err != nil {
+		return nil, err
+	}
+	name, namespace, err := extractName(item)
+	if err != nil {
+		return nil, err
+	}
+	return &InputPolicy{Name: name, Namespace: namespace, Policy: policy}, nil
+}
+
+// ConvertToRbac converts unstructured objects of the v1alpha1 RBAC resources to InputRbac.
+func ConvertToRbac(items []unstructured.Unstructured) (*InputRbac, error) {
+	ret := &InputRbac{}
+	for _, item := range items {
+		name, namespace, err := extractName(item)
+		if err != nil {
+			return nil, err
+		}
+		switch item.GetKind() {
+		case "ClusterRbacConfig", "RbacConfig":
+			config := &rbacpb.RbacConfig{}
+			if err := unstructuredToProto(item, config); err != nil {
+				return nil, err
+			}
+			ret.Configs = append(ret.Configs, &InputRbacConfig{Kind: item.GetKind(), Name: name, Namespace: namespace, Config: config})
+		case "ServiceRole":
+			role := &rbacpb.ServiceRole{}
+			if err := unstructuredToProto(item, role); err != nil {
+				return nil, err
+			}
+			ret.Roles = append(ret.Roles, &InputServiceRole{Name: name, Namespace: namespace, Role: role})
+		case "ServiceRoleBinding":
+			binding := &rbacpb.ServiceRoleBinding{}
+			if err := unstructuredToProto(item, binding); err != nil {
+				return nil, err
+			}
+			ret.Bindings = append(ret.Bindings, &InputServiceRoleBinding{Name: name, Namespace: namespace, Binding: binding})
+		default:
+			return nil, fmt.Errorf("unsupported RBAC resource kind %s", item.GetKind())
+		}
+	}
+	return ret, nil
+}
+
+// ConvertToDestinationRule converts unstructured object to InputDestinationRule.
+func ConvertToDestinationRule(item unstructured.Unstructured) (*InputDestinationRule, error) {
+	rule := &networkingpb.DestinationRule{}
+	if err := unstructuredToProto(item, rule); err != nil {
+		return nil, err
+	}
+	name, namespace, err := extractName(item)
+	if err != nil {
+		return nil, err
+	}
+	return &InputDestinationRule{Name: name, Namespace: namespace, Rule: rule}, nil
+}
+
+func unstructuredToProto(item unstructured.Unstructured, msg proto.Message) error {
 	spec, ok := item.UnstructuredContent()["spec"].(map[string]interface{})
 	if !ok {
-		return nil, fmt.Errorf("failed to extract spec from item")
+		return fmt.Errorf("failed to extract spec from item")
 	}
 	specString, err := json.Marshal(spec)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal spec %v to string: %w", spec, err)
+		return fmt.Errorf("failed to marshal spec %v to string: %w", spec, err)
 	}
-	policy := &authnpb.Policy{}
-	if err := jsonpb.UnmarshalString(string(specString), policy); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal string %s to proto: %w", specString, err)
+	if err := jsonpb.UnmarshalString(string(specString), msg); err != nil {
+		return fmt.Errorf("failed to unmarshal string %s to proto: %w", specString, err)
 	}
+	return nil
+}
+
+func extractName(item unstructured.Unstructured) (string, string, error) {
 	name, ok, err := unstructured.NestedString(item.Object, "metadata", "name")
 	if !ok || err != nil {
-		return nil, fmt.Errorf("failed to extract name: %w", err)
+		return "", "", fmt.Errorf("failed to extract name: %w", err)
 	}
 	namespace, _, err := unstructured.NestedString(item.Object, "metadata", "namespace")
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract namespace: %w", err)
+		return "", "", fmt.Errorf("failed to extract namespace: %w", err)
 	}
-	return &InputPolicy{Name: name, Namespace: namespace, Policy: policy}, nil
+	return name, namespace, nil
 }
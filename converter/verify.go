@@ -0,0 +1,539 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	authnpb "istio.io/api/authentication/v1alpha1"
+	betapb "istio.io/api/security/v1beta1"
+	commonpb "istio.io/api/type/v1beta1"
+)
+
+const (
+	// verifyPeerPrincipal and verifySubject are used as the identities of the representative requests.
+	verifyPeerPrincipal = "cluster.local/ns/verify/sa/verify"
+	verifySubject       = "verify-subject"
+)
+
+// VerifyRequest is a representative request sent to a workload selected by the alpha policy.
+type VerifyRequest struct {
+	// Workload describes the workload receiving the request, e.g. "service foo" or "namespace level policy".
+	Workload string `json:"workload"`
+	Port     uint32 `json:"port"`
+	Path     string `json:"path"`
+	// PeerCertificate is true if the request is sent with mTLS and a client certificate.
+	PeerCertificate bool `json:"peerCertificate"`
+	// JWTIssuer is the issuer of the valid JWT included in the request, empty if the request has no JWT.
+	JWTIssuer string `json:"jwtIssuer,omitempty"`
+}
+
+func (r *VerifyRequest) String() string {
+	jwt := "no JWT"
+	if r.JWTIssuer != "" {
+		jwt = fmt.Sprintf("JWT from %s", r.JWTIssuer)
+	}
+	peer := "plaintext"
+	if r.PeerCertificate {
+		peer = "mTLS"
+	}
+	return fmt.Sprintf("%s port %d path %s with %s and %s", r.Workload, r.Port, r.Path, peer, jwt)
+}
+
+// Decision is the result of evaluating a request against the policies.
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func (d Decision) String() string {
+	ret := "DENY"
+	if d.Allowed {
+		ret = "ALLOW"
+	}
+	if d.Reason != "" {
+		ret = fmt.Sprintf("%s (%s)", ret, d.Reason)
+	}
+	return ret
+}
+
+// VerifyMismatch is a request that has different decision in the alpha and beta policies.
+type VerifyMismatch struct {
+	Request *VerifyRequest `json:"request"`
+	Alpha   Decision       `json:"alpha"`
+	Beta    Decision       `json:"beta"`
+}
+
+// VerifyResult includes the result of verifying the beta policies against the alpha policy.
+type VerifyResult struct {
+	// Requests is the number of representative requests evaluated.
+	Requests   int               `json:"requests"`
+	Mismatches []*VerifyMismatch `json:"mismatches,omitempty"`
+	// Errors includes the beta policy fields that could not be evaluated, the requests are not compared in this case.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// verifyWorkload is a workload selected by the alpha policy.
+type verifyWorkload struct {
+	comment   string
+	namespace string
+	labels    map[string]string
+	// ports is the workload ports selected by the alpha policy, empty means all ports are selected.
+	ports []uint32
+}
+
+// Verify checks the beta policies converted from the alpha authentication policy are semantically equivalent to the
+// alpha policy. It enumerates representative requests (with and without peer certificate and JWT, on each trigger rule
+// path and each port) for the workloads selected by the alpha policy, evaluates them against both the alpha and beta
+// policies and reports the requests that have different decision. The difference of the denial status code (401 in
+// alpha v.s. 403 in beta) is not considered as a mismatch. The output may also include the beta policies converted from
+// the less specific alpha policies, they decide the ports not selected by the alpha policy.
+func (mc *Converter) Verify(input *InputPolicy, output []*OutputPolicy) *VerifyResult {
+	result := &VerifyResult{}
+	errors := map[string]bool{}
+	// others includes the beta policies not converted from the alpha policy, e.g. the namespace level policies.
+	var others []*OutputPolicy
+	for _, out := range output {
+		if out.Source != inputReference(input) {
+			others = append(others, out)
+		}
+	}
+	for _, workload := range mc.verifyWorkloads(input) {
+		for _, req := range verifyRequests(input, workload) {
+			result.Requests++
+			alpha := evaluateAlpha(input.Policy, workload, req)
+			if len(workload.ports) != 0 && !containsPort(workload.ports, req.Port) {
+				// The port is governed by the less specific policies in alpha, the beta policies converted from the
+				// alpha policy must not change the decision of the other beta policies.
+				decision, err := mc.evaluateBeta(others, workload, req)
+				if err != nil {
+					errors[err.Error()] = true
+					continue
+				}
+				alpha = Decision{Allowed: decision.Allowed, Reason: "port not selected by the alpha policy"}
+			}
+			beta, err := mc.evaluateBeta(output, workload, req)
+			if err != nil {
+				errors[err.Error()] = true
+				continue
+			}
+			if alpha.Allowed != beta.Allowed {
+				result.Mismatches = append(result.Mismatches, &VerifyMismatch{Request: req, Alpha: alpha, Beta: beta})
+			}
+		}
+	}
+	for err := range errors {
+		result.Errors = append(result.Errors, err)
+	}
+	sort.Strings(result.Errors)
+	return result
+}
+
+func (mc *Converter) verifyWorkloads(input *InputPolicy) []*verifyWorkload {
+	if len(input.Policy.Targets) == 0 {
+		comment := "namespace level policy"
+		if input.Namespace == "" {
+			comment = "mesh level policy"
+		}
+		return []*verifyWorkload{{comment: comment, namespace: input.Namespace}}
+	}
+
+	var ret []*verifyWorkload
+	for _, target := range input.Policy.Targets {
+		selector, err := mc.Service.serviceToSelector(target.Name, input.Namespace)
+		if err != nil {
+			// Already reported in the conversion.
+			continue
+		}
+		workload := &verifyWorkload{
+			comment:   fmt.Sprintf("service %s", target.Name),
+			namespace: input.Namespace,
+			labels:    selector.MatchLabels,
+		}
+		for _, port := range target.Ports {
+			if workloadPort, err := mc.Service.svcPortToWorkloadPort(target.Name, input.Namespace, port); err == nil {
+				workload.ports = append(workload.ports, workloadPort)
+			}
+		}
+		ret = append(ret, workload)
+	}
+	return ret
+}
+
+func verifyRequests(input *InputPolicy, workload *verifyWorkload) []*VerifyRequest {
+	// Always include a port not selected by the alpha policy to make sure the beta policy is not applied to it.
+	ports := append([]uint32{}, workload.ports...)
+	otherPort := uint32(80)
+	for _, port := range workload.ports {
+		if port >= otherPort {
+			otherPort = port + 1
+		}
+	}
+	ports = append(ports, otherPort)
+
+	paths := []string{"/", "/verify-other-path"}
+	issuers := []string{""}
+	for _, origin := range input.Policy.Origins {
+		if origin.GetJwt() == nil {
+			continue
+		}
+		issuers = append(issuers, origin.GetJwt().Issuer)
+		for _, trigger := range origin.GetJwt().TriggerRules {
+			for _, match := range append(append([]*authnpb.StringMatch{}, trigger.IncludedPaths...), trigger.ExcludedPaths...) {
+				paths = append(paths, samplePaths(match)...)
+			}
+		}
+	}
+	paths = uniqueStrings(paths)
+
+	var ret []*VerifyRequest
+	for _, port := range ports {
+		for _, path := range paths {
+			for _, peer := range []bool{false, true} {
+				for _, issuer := range issuers {
+					ret = append(ret, &VerifyRequest{
+						Workload:        workload.comment,
+						Port:            port,
+						Path:            path,
+						PeerCertificate: peer,
+						JWTIssuer:       issuer,
+					})
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// samplePaths returns the paths that match the string match, the regex match is sampled with the translated paths.
+func samplePaths(match *authnpb.StringMatch) []string {
+	switch {
+	case match.GetExact() != "":
+		return []string{match.GetExact()}
+	case match.GetPrefix() != "":
+		return []string{match.GetPrefix(), match.GetPrefix() + "verify"}
+	case match.GetSuffix() != "":
+		return []string{"/verify" + match.GetSuffix()}
+	case match.GetRegex() != "":
+		paths, _ := regexPaths(match.GetRegex())
+		var ret []string
+		for _, path := range paths {
+			switch {
+			case path == "*":
+				ret = append(ret, "/verify")
+			case strings.HasSuffix(path, "*"):
+				ret = append(ret, strings.TrimSuffix(path, "*"), strings.TrimSuffix(path, "*")+"verify")
+			case strings.HasPrefix(path, "*"):
+				ret = append(ret, "/verify"+strings.TrimPrefix(path, "*"))
+			default:
+				ret = append(ret, path)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+func uniqueStrings(values []string) []string {
+	var ret []string
+	found := map[string]bool{}
+	for _, v := range values {
+		if !found[v] {
+			found[v] = true
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// evaluateAlpha evaluates the request against the alpha authentication policy.
+func evaluateAlpha(policy *authnpb.Policy, workload *verifyWorkload, req *VerifyRequest) Decision {
+	if len(workload.ports) != 0 && !containsPort(workload.ports, req.Port) {
+		return Decision{Allowed: true, Reason: "port not selected by the alpha policy"}
+	}
+
+	// The first mTLS peer method is used in alpha.
+	for _, peer := range policy.Peers {
+		if mtls := peer.GetMtls(); mtls != nil {
+			if mtls.Mode != authnpb.MutualTls_PERMISSIVE && !policy.PeerIsOptional && !req.PeerCertificate {
+				return Decision{Reason: "mTLS is required"}
+			}
+			break
+		}
+	}
+
+	// The origin authentication is only performed if any of the origin is triggered by the request path.
+	var triggered []string
+	for _, origin := range policy.Origins {
+		if jwt := origin.GetJwt(); jwt != nil && alphaTriggered(jwt.TriggerRules, req.Path) {
+			triggered = append(triggered, jwt.Issuer)
+		}
+	}
+	if len(triggered) == 0 || policy.OriginIsOptional {
+		return Decision{Allowed: true}
+	}
+	for _, issuer := range triggered {
+		if issuer == req.JWTIssuer {
+			return Decision{Allowed: true}
+		}
+	}
+	return Decision{Reason: fmt.Sprintf("JWT is required from %s", strings.Join(triggered, ", "))}
+}
+
+func alphaTriggered(rules []*authnpb.Jwt_TriggerRule, path string) bool {
+	if len(rules) == 0 {
+		return true
+	}
+	for _, rule := range rules {
+		if len(rule.IncludedPaths) != 0 && !alphaMatchAny(rule.IncludedPaths, path) {
+			continue
+		}
+		if alphaMatchAny(rule.ExcludedPaths, path) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func alphaMatchAny(matches []*authnpb.StringMatch, path string) bool {
+	for _, match := range matches {
+		switch {
+		case match.GetExact() != "" && path == match.GetExact():
+			return true
+		case match.GetPrefix() != "" && strings.HasPrefix(path, match.GetPrefix()):
+			return true
+		case match.GetSuffix() != "" && strings.HasSuffix(path, match.GetSuffix()):
+			return true
+		case match.GetRegex() != "":
+			// The regex must match the whole path.
+			if re, err := regexp.Compile("^(?:" + match.GetRegex() + ")$"); err == nil && re.MatchString(path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evaluateBeta evaluates the request against the beta policies that apply to the workload.
+func (mc *Converter) evaluateBeta(output []*OutputPolicy, workload *verifyWorkload, req *VerifyRequest) (Decision, error) {
+	var jwtRules []*betapb.JWTRule
+	var denies, allows []*OutputPolicy
+	for _, out := range output {
+		if out.RequestAuthN != nil && mc.betaApplies(out.Namespace, out.RequestAuthN.Selector, workload) {
+			jwtRules = append(jwtRules, out.RequestAuthN.JwtRules...)
+		}
+		if out.Authz != nil && mc.betaApplies(out.Namespace, out.Authz.Selector, workload) {
+			if out.Authz.Action == betapb.AuthorizationPolicy_DENY {
+				denies = append(denies, out)
+			} else {
+				allows = append(allows, out)
+			}
+		}
+	}
+
+	// The UNSET mode (e.g. the PeerAuthentication with only port level mTLS) inherits from the less specific one.
+	if mode, _ := mc.effectiveMTLS(output, workload.namespace, workload.labels, req.Port); mode == betapb.PeerAuthentication_MutualTLS_STRICT && !req.PeerCertificate {
+		return Decision{Reason: "PeerAuthentication STRICT mode"}, nil
+	}
+
+	requestPrincipal := ""
+	for _, rule := range jwtRules {
+		if req.JWTIssuer != "" && rule.Issuer == req.JWTIssuer {
+			requestPrincipal = req.JWTIssuer + "/" + verifySubject
+			break
+		}
+	}
+
+	for _, deny := range denies {
+		matched, err := betaMatchRules(deny, req, requestPrincipal)
+		if err != nil {
+			return Decision{}, err
+		}
+		if matched {
+			return Decision{Reason: fmt.Sprintf("denied by AuthorizationPolicy %s/%s", deny.Namespace, deny.Name)}, nil
+		}
+	}
+	if len(allows) == 0 {
+		return Decision{Allowed: true}, nil
+	}
+	for _, allow := range allows {
+		matched, err := betaMatchRules(allow, req, requestPrincipal)
+		if err != nil {
+			return Decision{}, err
+		}
+		if matched {
+			return Decision{Allowed: true}, nil
+		}
+	}
+	return Decision{Reason: "no matching ALLOW AuthorizationPolicy"}, nil
+}
+
+// betaApplies returns true if the beta policy in the namespace with the selector applies to the workload.
+func (mc *Converter) betaApplies(namespace string, selector *commonpb.WorkloadSelector, workload *verifyWorkload) bool {
+	if namespace != mc.RootNamespace && namespace != workload.namespace {
+		return false
+	}
+	return labelsSubset(selector.GetMatchLabels(), workload.labels)
+}
+
+func (mc *Converter) betaRank(namespace string, selector *commonpb.WorkloadSelector) int {
+	if len(selector.GetMatchLabels()) != 0 {
+		return 2
+	}
+	if namespace != mc.RootNamespace {
+		return 1
+	}
+	return 0
+}
+
+// peerAuthentications returns the PeerAuthentications that apply to the workload, the most specific one first.
+func (mc *Converter) peerAuthentications(outputs []*OutputPolicy, workload *verifyWorkload) []*OutputPolicy {
+	var ret []*OutputPolicy
+	for _, out := range outputs {
+		if out.PeerAuthN != nil && mc.betaApplies(out.Namespace, out.PeerAuthN.Selector, workload) {
+			ret = append(ret, out)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return mc.betaRank(ret[i].Namespace, ret[i].PeerAuthN.Selector) > mc.betaRank(ret[j].Namespace, ret[j].PeerAuthN.Selector)
+	})
+	return ret
+}
+
+// effectiveMTLS returns the effective mTLS mode of the workload port (0 for the workload without port level mTLS) and
+// the PeerAuthentication that sets the mode, the PeerAuthentication is nil if the default PERMISSIVE mode is used. The
+// most specific PeerAuthentication wins, its port level mTLS only applies if it has a workload selector, and the UNSET
+// mode inherits from the less specific one.
+func (mc *Converter) effectiveMTLS(outputs []*OutputPolicy, namespace string, labels map[string]string, port uint32) (
+	betapb.PeerAuthentication_MutualTLS_Mode, *OutputPolicy) {
+	for i, out := range mc.peerAuthentications(outputs, &verifyWorkload{namespace: namespace, labels: labels}) {
+		if i == 0 && port != 0 && len(out.PeerAuthN.Selector.GetMatchLabels()) != 0 {
+			if mtls, found := out.PeerAuthN.PortLevelMtls[port]; found && mtls.Mode != betapb.PeerAuthentication_MutualTLS_UNSET {
+				return mtls.Mode, out
+			}
+		}
+		if mode := out.PeerAuthN.GetMtls().GetMode(); mode != betapb.PeerAuthentication_MutualTLS_UNSET {
+			return mode, out
+		}
+	}
+	return betapb.PeerAuthentication_MutualTLS_PERMISSIVE, nil
+}
+
+func betaMatchRules(policy *OutputPolicy, req *VerifyRequest, requestPrincipal string) (bool, error) {
+	for i, rule := range policy.Authz.Rules {
+		field := fmt.Sprintf("AuthorizationPolicy %s/%s rules[%d]", policy.Namespace, policy.Name, i)
+		matched, err := betaMatchRule(rule, req, requestPrincipal)
+		if err != nil {
+			return false, fmt.Errorf("%s: %v", field, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func betaMatchRule(rule *betapb.Rule, req *VerifyRequest, requestPrincipal string) (bool, error) {
+	peerPrincipal := ""
+	if req.PeerCertificate {
+		peerPrincipal = verifyPeerPrincipal
+	}
+
+	if len(rule.From) != 0 {
+		matched := false
+		for _, from := range rule.From {
+			source := from.GetSource()
+			if len(source.GetNamespaces()) != 0 || len(source.GetNotNamespaces()) != 0 ||
+				len(source.GetIpBlocks()) != 0 || len(source.GetNotIpBlocks()) != 0 {
+				return false, fmt.Errorf("namespaces and ipBlocks are not supported in verification")
+			}
+			if betaMatchValues(source.GetPrincipals(), source.GetNotPrincipals(), peerPrincipal) &&
+				betaMatchValues(source.GetRequestPrincipals(), source.GetNotRequestPrincipals(), requestPrincipal) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+
+	if len(rule.To) != 0 {
+		matched := false
+		port := strconv.Itoa(int(req.Port))
+		for _, to := range rule.To {
+			op := to.GetOperation()
+			if len(op.GetHosts()) != 0 || len(op.GetNotHosts()) != 0 ||
+				len(op.GetMethods()) != 0 || len(op.GetNotMethods()) != 0 {
+				return false, fmt.Errorf("hosts and methods are not supported in verification")
+			}
+			if betaMatchValues(op.GetPaths(), op.GetNotPaths(), req.Path) &&
+				betaMatchValues(op.GetPorts(), op.GetNotPorts(), port) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+
+	for _, condition := range rule.When {
+		if condition.Key != "request.auth.claims[iss]" {
+			return false, fmt.Errorf("condition %s is not supported in verification", condition.Key)
+		}
+		// The request principal is in the format of <iss>/<sub>.
+		issuer := ""
+		if requestPrincipal != "" {
+			issuer = strings.TrimSuffix(requestPrincipal, "/"+verifySubject)
+		}
+		if !betaMatchValues(condition.Values, condition.NotValues, issuer) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// betaMatchValues returns true if the value matches the values (if not empty) and does not match the notValues. An
+// empty value (e.g. no principal) never matches any pattern including "*".
+func betaMatchValues(values, notValues []string, value string) bool {
+	if len(values) != 0 && !betaMatchAny(values, value) {
+		return false
+	}
+	return !betaMatchAny(notValues, value)
+}
+
+func betaMatchAny(patterns []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		switch {
+		case pattern == "*":
+			return true
+		case strings.HasPrefix(pattern, "*"):
+			if strings.HasSuffix(value, pattern[1:]) {
+				return true
+			}
+		case strings.HasSuffix(pattern, "*"):
+			if strings.HasPrefix(value, pattern[:len(pattern)-1]) {
+				return true
+			}
+		case pattern == value:
+			return true
+		}
+	}
+	return false
+}
+
+func containsPort(ports []uint32, port uint32) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
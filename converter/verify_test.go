@@ -0,0 +1,289 @@
+package converter
+
+import (
+	"testing"
+
+	betapb "istio.io/api/security/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestConverter_Verify(t *testing.T) {
+	svcList := &corev1.ServiceList{
+		Items: []corev1.Service{
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "httpbin",
+					Namespace: "foo",
+				},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{
+						"app": "httpbin",
+					},
+					Ports: []corev1.ServicePort{
+						{
+							Name:       "http",
+							Port:       8000,
+							TargetPort: intstr.FromInt(80),
+						},
+					},
+				},
+			},
+		},
+	}
+	cases := []struct {
+		name         string
+		inputPolicy  *InputPolicy
+		modifyOutput func(output []*OutputPolicy)
+		// otherOutput includes the beta policies converted from other alpha policies.
+		otherOutput    []*OutputPolicy
+		wantMismatches bool
+		wantErrors     bool
+	}{
+		{
+			name: "mesh-level-strict",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: MeshPolicy
+metadata:
+  name: default
+spec:
+  peers:
+  - mtls:
+      mode: STRICT
+`),
+		},
+		{
+			name: "service-port-level-mtls-and-jwt",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: foo
+spec:
+  targets:
+  - name: httpbin
+    ports:
+    - number: 8000
+  peers:
+  - mtls: {}
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+  principalBinding: USE_ORIGIN
+`),
+		},
+		{
+			name: "service-port-level-mtls-and-namespace-strict",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: foo
+spec:
+  targets:
+  - name: httpbin
+    ports:
+    - number: 8000
+  peers:
+  - mtls:
+      mode: PERMISSIVE
+`),
+			// The other ports inherit the STRICT mode from the namespace level PeerAuthentication.
+			otherOutput: []*OutputPolicy{{
+				Name:      "default",
+				Namespace: "foo",
+				Source:    ObjectReference{Kind: "Policy", Namespace: "foo", Name: "default"},
+				PeerAuthN: &betapb.PeerAuthentication{
+					Mtls: &betapb.PeerAuthentication_MutualTLS{Mode: betapb.PeerAuthentication_MutualTLS_STRICT},
+				},
+			}},
+		},
+		{
+			name: "jwt-trigger-rule",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+spec:
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+      triggerRules:
+      - includedPaths:
+        - prefix: /api
+        excludedPaths:
+        - exact: /api/health
+      - includedPaths:
+        - suffix: /admin
+`),
+		},
+		{
+			name: "jwt-trigger-rule-regex",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+spec:
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+      triggerRules:
+      - includedPaths:
+        - regex: "^/api/(v1|v2)/.*$"
+        excludedPaths:
+        - regex: "/api/v[12]/health|.*\\.json"
+`),
+		},
+		{
+			name: "jwt-origin-optional",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+spec:
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+  originIsOptional: true
+`),
+		},
+		{
+			name: "jwt-multiple-issuers-trigger-rule",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+spec:
+  origins:
+  - jwt:
+      issuer: "issuer-1"
+      jwksUri: "https://secure.istio.io"
+      triggerRules:
+      - includedPaths:
+        - prefix: /one
+  - jwt:
+      issuer: "issuer-2"
+      jwksUri: "https://secure.istio.io"
+`),
+		},
+		{
+			name: "jwt-multiple-issuers-trigger-rules",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+spec:
+  origins:
+  - jwt:
+      issuer: "issuer-1"
+      jwksUri: "https://secure.istio.io"
+      triggerRules:
+      - includedPaths:
+        - prefix: /one
+        excludedPaths:
+        - exact: /one/health
+      - includedPaths:
+        - exact: /shared
+  - jwt:
+      issuer: "issuer-2"
+      jwksUri: "https://secure.istio.io"
+      triggerRules:
+      - excludedPaths:
+        - prefix: /one
+        - exact: /public
+`),
+		},
+		{
+			name: "modified-output-missing-port",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+  namespace: foo
+spec:
+  targets:
+  - name: httpbin
+    ports:
+    - number: 8000
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+`),
+			modifyOutput: func(output []*OutputPolicy) {
+				for _, out := range output {
+					if out.Authz != nil {
+						out.Authz.Rules[0].To = nil
+					}
+				}
+			},
+			wantMismatches: true,
+		},
+		{
+			name: "modified-output-unsupported-field",
+			inputPolicy: inputPolicy(t, `
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+spec:
+  origins:
+  - jwt:
+      issuer: "testing@secure.istio.io"
+      jwksUri: "https://secure.istio.io"
+`),
+			modifyOutput: func(output []*OutputPolicy) {
+				for _, out := range output {
+					if out.Authz != nil {
+						out.Authz.Rules[0].From[0].Source.Namespaces = []string{"foo"}
+					}
+				}
+			},
+			wantErrors: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mc := NewConverter("istio-system", svcList)
+			output, _ := mc.Convert(tc.inputPolicy)
+			if tc.modifyOutput != nil {
+				tc.modifyOutput(output)
+			}
+			output = append(output, tc.otherOutput...)
+			got := mc.Verify(tc.inputPolicy, output)
+			if got.Requests == 0 {
+				t.Fatalf("want requests evaluated but got 0")
+			}
+			if gotMismatches := len(got.Mismatches) != 0; gotMismatches != tc.wantMismatches {
+				for _, m := range got.Mismatches {
+					t.Logf("mismatch: %s: alpha %s, beta %s", m.Request, m.Alpha, m.Beta)
+				}
+				t.Errorf("want mismatches %v but got %d", tc.wantMismatches, len(got.Mismatches))
+			}
+			if gotErrors := len(got.Errors) != 0; gotErrors != tc.wantErrors {
+				t.Errorf("want errors %v but got %v", tc.wantErrors, got.Errors)
+			}
+		})
+	}
+}
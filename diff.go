@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+	"github.com/spf13/cobra"
+)
+
+func diffCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff",
+		Short: "Compare the converted beta policies to the beta policies already in the cluster.",
+		Long: `Diff converts the v1alpha1 policies and compares each beta policy to the existing beta policies in the cluster,
+the beta policy is reported as NEW, CHANGED (with the spec difference), IDENTICAL or CONFLICTING. A beta policy is
+conflicting if it has the same name as a hand-authored policy or a policy converted from a different alpha policy, or
+if its selector overlaps with a hand-authored PeerAuthentication or RequestAuthentication.`,
+		Example: `
+# Compare the beta policies converted from the current cluster to the existing beta policies:
+./convert diff
+
+# Compare the beta policies converted from local files to the existing beta policies in the current cluster:
+./convert diff --input alpha-policy.yaml --input k8s-services/
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := loadResources()
+			if err != nil {
+				return err
+			}
+			outputs, err := convertAll(res, newRunID())
+			if err != nil {
+				return err
+			}
+			client, err := newKubeClient(kubeconfig, configContext)
+			if err != nil {
+				log.Fatalf("failed to create kube client: %v", err)
+			}
+			return diff(client, outputs)
+		},
+	}
+}
+
+func diff(client *kubeClient, outputs []*converter.OutputPolicy) error {
+	var generated []*converter.ObjectStruct
+	for _, out := range outputs {
+		generated = append(generated, out.ToObjects()...)
+	}
+	existing, err := client.listBeta()
+	if err != nil {
+		return err
+	}
+	printDiffs(converter.Diff(generated, existing), true)
+	return nil
+}
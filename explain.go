@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func explainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "explain <namespace> <pod|service>/<name>",
+		Short: "Explain the alpha and beta authentication policies that apply to a pod or service.",
+		Long: `Explain shows the v1alpha1 authentication policy that governs the pod or service (at service, namespace or mesh
+level), the beta policies generated by the tool that apply to it, and the resulting effective mTLS mode, JWT issuers
+and the requests that require JWT in beta.`,
+		Example: `
+# Explain the authentication of the pod httpbin-5c7f4b7d8-x2x9v in namespace foo in the current cluster:
+./convert explain foo pod/httpbin-5c7f4b7d8-x2x9v
+
+# Explain the authentication of the service httpbin in namespace foo with the policies in local files:
+./convert explain foo service/httpbin --input alpha-policy.yaml --input k8s-services/
+`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if explainOutput != "text" && explainOutput != "json" {
+				return fmt.Errorf("unsupported output format %q, must be text or json", explainOutput)
+			}
+			res, err := loadResources()
+			if err != nil {
+				return err
+			}
+			workload, err := explainWorkload(res, args[0], args[1])
+			if err != nil {
+				return err
+			}
+			return explain(res, workload)
+		},
+	}
+	cmd.Flags().StringVarP(&explainOutput, "output", "o", "text", "the output format, text or json")
+	return cmd
+}
+
+// explainWorkload finds the pod or service to explain in the resources, the pod is read from the cluster if it is not
+// included in the resources.
+func explainWorkload(res *resources, namespace, name string) (*converter.ExplainWorkload, error) {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid workload %q, must be pod/<name> or service/<name>", name)
+	}
+	kind, name := strings.ToLower(parts[0]), parts[1]
+	switch kind {
+	case "service", "services", "svc":
+		for _, svc := range res.services.Items {
+			if svc.Namespace == namespace && svc.Name == name {
+				return &converter.ExplainWorkload{Kind: "Service", Namespace: namespace, Name: name, Labels: svc.Spec.Selector}, nil
+			}
+		}
+		return nil, fmt.Errorf("could not find service %s/%s", namespace, name)
+	case "pod", "pods", "po":
+		for _, pod := range res.pods {
+			if pod.Namespace == namespace && pod.Name == name {
+				return &converter.ExplainWorkload{Kind: "Pod", Namespace: namespace, Name: name, Labels: pod.Labels}, nil
+			}
+		}
+		if len(inputFiles) != 0 {
+			return nil, fmt.Errorf("could not find pod %s/%s in input", namespace, name)
+		}
+		client, err := newKubeClient(kubeconfig, configContext)
+		if err != nil {
+			log.Fatalf("failed to create kube client: %v", err)
+		}
+		pod, err := client.kubeClient.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pod %s/%s: %w", namespace, name, err)
+		}
+		res.pods = append(res.pods, *pod)
+		return &converter.ExplainWorkload{Kind: "Pod", Namespace: namespace, Name: name, Labels: pod.Labels}, nil
+	}
+	return nil, fmt.Errorf("unsupported workload kind %q, must be pod or service", parts[0])
+}
+
+func explain(res *resources, workload *converter.ExplainWorkload) error {
+	var inputs []*converter.InputPolicy
+	for _, item := range res.policies {
+		policy, err := converter.ConvertToPolicy(item)
+		if err != nil {
+			return fmt.Errorf("failed to convert resource to authentication policy: %v", err)
+		}
+		inputs = append(inputs, policy)
+	}
+	outputs, err := convertAll(res, newRunID())
+	if err != nil {
+		return err
+	}
+	explanation := newConverter(res).Explain(workload, inputs, outputs)
+
+	if explainOutput == "json" {
+		data, err := json.MarshalIndent(explanation, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal explanation: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "Workload:      %s\n", explanation.Workload)
+	fmt.Fprintf(out, "Labels:        %s\n", labelsString(explanation.Labels))
+	fmt.Fprintf(out, "Services:      %s\n", strings.Join(explanation.Services, ", "))
+	fmt.Fprintf(out, "Alpha policies:\n")
+	if len(explanation.Alpha) == 0 {
+		fmt.Fprintf(out, "  <none>\n")
+	}
+	for _, alpha := range explanation.Alpha {
+		line := fmt.Sprintf("  - %s (%s level", alpha.Policy, alpha.Level)
+		if len(alpha.Ports) != 0 {
+			line = fmt.Sprintf("%s, ports %v", line, alpha.Ports)
+		}
+		if alpha.Service != "" {
+			line = fmt.Sprintf("%s, via service %s", line, alpha.Service)
+		}
+		fmt.Fprintf(out, "%s)\n", line)
+	}
+	fmt.Fprintf(out, "Beta policies:\n")
+	if len(explanation.Beta) == 0 {
+		fmt.Fprintf(out, "  <none>\n")
+	}
+	for _, ref := range explanation.Beta {
+		fmt.Fprintf(out, "  - %s\n", ref)
+	}
+	fmt.Fprintf(out, "Effective mTLS: %s\n", explanation.MTLS)
+	var ports []int
+	for port := range explanation.PortMTLS {
+		ports = append(ports, int(port))
+	}
+	sort.Ints(ports)
+	for _, port := range ports {
+		fmt.Fprintf(out, "  - port %d: %s\n", port, explanation.PortMTLS[uint32(port)])
+	}
+	fmt.Fprintf(out, "JWT issuers:   %s\n", strings.Join(explanation.JWTIssuers, ", "))
+	fmt.Fprintf(out, "Required JWT:\n")
+	if len(explanation.RequiredJWT) == 0 {
+		fmt.Fprintf(out, "  <none>\n")
+	}
+	for _, required := range explanation.RequiredJWT {
+		fmt.Fprintf(out, "  - %s\n", required)
+	}
+	_, err = os.Stdout.WriteString(out.String())
+	return err
+}
+
+func labelsString(labels map[string]string) string {
+	var ret []string
+	for k, v := range labels {
+		ret = append(ret, k+"="+v)
+	}
+	sort.Strings(ret)
+	return strings.Join(ret, ",")
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// stdinInput is the input file name used to read from stdin.
+const stdinInput = "-"
+
+// loadFiles reads all resources needed by the conversion from the given files, directories or stdin.
+func loadFiles(paths []string) (*resources, error) {
+	var objects []unstructured.Unstructured
+	for _, path := range paths {
+		items, err := readPath(path)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, items...)
+	}
+
+	res := &resources{services: &corev1.ServiceList{}}
+	// found includes the namespaces in the input, either the Namespace objects or the namespaces of other objects.
+	found := map[string]bool{}
+	for _, item := range objects {
+		gvk := item.GroupVersionKind()
+		// Namespaced resources without namespace are created in the default namespace by kubectl, keep the same behavior.
+		if item.GetNamespace() == "" && gvk.Kind != "MeshPolicy" && gvk.Kind != "Namespace" && !strings.HasPrefix(gvk.Kind, "Cluster") {
+			item.SetNamespace(metav1.NamespaceDefault)
+		}
+		if item.GetNamespace() != "" {
+			found[item.GetNamespace()] = true
+		}
+		switch {
+		case gvk.Group == "authentication.istio.io" && (gvk.Kind == "Policy" || gvk.Kind == "MeshPolicy"):
+			res.policies = append(res.policies, item)
+		case gvk.Group == "rbac.istio.io":
+			res.rbac = append(res.rbac, item)
+		case gvk.Group == "networking.istio.io" && gvk.Kind == "DestinationRule":
+			res.destinationRules = append(res.destinationRules, item)
+		case gvk.Group == "" && gvk.Kind == "Service":
+			svc := corev1.Service{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &svc); err != nil {
+				return nil, fmt.Errorf("failed to convert service %s/%s: %w", item.GetNamespace(), item.GetName(), err)
+			}
+			res.services.Items = append(res.services.Items, svc)
+		case gvk.Group == "" && gvk.Kind == "Namespace":
+			found[item.GetName()] = true
+		case gvk.Group == "" && gvk.Kind == "Pod":
+			pod := corev1.Pod{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &pod); err != nil {
+				return nil, fmt.Errorf("failed to convert pod %s/%s: %w", item.GetNamespace(), item.GetName(), err)
+			}
+			res.pods = append(res.pods, pod)
+		case gvk.Group == "" && gvk.Kind == "ConfigMap" && item.GetName() == meshConfigMapName() &&
+			(istioNamespace == "" || item.GetNamespace() == istioNamespace):
+			// The control plane namespace is discovered from the mesh config map if not set with the flag.
+			if res.meshConfig != nil {
+				return nil, fmt.Errorf("found multiple mesh config %s in %s and %s, use --istio-namespace to select one",
+					meshConfigMapName(), res.meshConfig.Namespace, item.GetNamespace())
+			}
+			data, _, err := unstructured.NestedStringMap(item.Object, "data")
+			if err != nil {
+				return nil, fmt.Errorf("failed to extract data from mesh config: %w", err)
+			}
+			if res.rootNamespace, res.meshConfig, err = parseMeshConfig(item.GetNamespace(), item.GetName(), data); err != nil {
+				return nil, err
+			}
+		default:
+			log.Printf("skipped unrelated resource %s: %s/%s", gvk.Kind, item.GetNamespace(), item.GetName())
+		}
+	}
+	switch {
+	case res.meshConfig != nil:
+		istioNamespace = res.meshConfig.Namespace
+	case istioNamespace == "":
+		istioNamespace = defaultIstioNamespace
+	}
+	if res.rootNamespace == "" {
+		log.Printf("could not find mesh config %s in input, using %s as default root namespace", meshConfigMapName(), istioNamespace)
+		res.rootNamespace = istioNamespace
+	}
+	for ns := range found {
+		res.namespaces = append(res.namespaces, ns)
+	}
+	sort.Strings(res.namespaces)
+	return res, nil
+}
+
+// readPath reads the objects from a file, all YAML and JSON files (and backup archives) in a directory or stdin.
+func readPath(path string) ([]unstructured.Unstructured, error) {
+	if path == stdinInput {
+		return readObjects(os.Stdin, "stdin")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		if isArchive(path) {
+			return readArchive(path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open input %s: %w", path, err)
+		}
+		defer f.Close()
+		return readObjects(f, path)
+	}
+
+	var ret []unstructured.Unstructured
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			if !isArchive(file) {
+				return nil
+			}
+		}
+		items, err := readPath(file)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, items...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input directory %s: %w", path, err)
+	}
+	return ret, nil
+}
+
+// readObjects decodes the multi-document YAML or JSON from the reader, items in a List are flattened.
+func readObjects(r io.Reader, name string) ([]unstructured.Unstructured, error) {
+	decoder := kubeyaml.NewYAMLOrJSONDecoder(bufio.NewReader(r), 512*1024)
+	var ret []unstructured.Unstructured
+	for {
+		obj := map[string]interface{}{}
+		err := decoder.Decode(&obj)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		item := unstructured.Unstructured{Object: obj}
+		if item.IsList() {
+			list, err := item.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode list in %s: %w", name, err)
+			}
+			ret = append(ret, list.Items...)
+			continue
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
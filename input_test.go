@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadObjects(t *testing.T) {
+	cases := []struct {
+		name      string
+		input     string
+		want      []string
+		wantError string
+	}{
+		{
+			name: "multi-document",
+			input: `
+apiVersion: v1
+kind: Service
+metadata:
+  name: httpbin
+  namespace: foo
+---
+---
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: default
+  namespace: foo
+`,
+			want: []string{"Service/foo/httpbin", "Policy/foo/default"},
+		},
+		{
+			name: "list",
+			input: `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: httpbin
+    namespace: foo
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: sleep
+    namespace: bar
+`,
+			want: []string{"Service/foo/httpbin", "Service/bar/sleep"},
+		},
+		{
+			name:  "json",
+			input: `{"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "foo"}}`,
+			want:  []string{"Namespace//foo"},
+		},
+		{
+			name:      "invalid",
+			input:     "apiVersion: v1\nkind: [Service",
+			wantError: "failed to decode test",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			items, err := readObjects(strings.NewReader(tc.input), "test")
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("want error %q but got %v", tc.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want no error but got %v", err)
+			}
+			var got []string
+			for _, item := range items {
+				got = append(got, item.GetKind()+"/"+item.GetNamespace()+"/"+item.GetName())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want objects %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "input")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"policies.yaml": `
+apiVersion: authentication.istio.io/v1alpha1
+kind: MeshPolicy
+metadata:
+  name: default
+spec:
+  peers:
+  - mtls: {}
+---
+apiVersion: authentication.istio.io/v1alpha1
+kind: Policy
+metadata:
+  name: httpbin
+spec:
+  targets:
+  - name: httpbin
+---
+apiVersion: rbac.istio.io/v1alpha1
+kind: ServiceRole
+metadata:
+  name: viewer
+  namespace: bar
+`,
+		"k8s/services.json": `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "httpbin", "namespace": "default"}}`,
+		"k8s/namespaces.yml": `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: empty
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: httpbin
+  namespace: default
+`,
+		"k8s/mesh.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: istio
+  namespace: istio-control
+data:
+  mesh: |-
+    rootNamespace: istio-config
+`,
+		"k8s/README.md": "not an input",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	defer func(ns string) { istioNamespace = ns }(istioNamespace)
+	istioNamespace = ""
+
+	res, err := loadFiles([]string{dir})
+	if err != nil {
+		t.Fatalf("want no error but got %v", err)
+	}
+	var policies []string
+	for _, item := range res.policies {
+		policies = append(policies, item.GetKind()+"/"+item.GetNamespace()+"/"+item.GetName())
+	}
+	// The namespaced object without namespace is in the default namespace as with kubectl.
+	if want := []string{"MeshPolicy//default", "Policy/default/httpbin"}; !reflect.DeepEqual(policies, want) {
+		t.Errorf("want policies %v but got %v", want, policies)
+	}
+	if len(res.rbac) != 1 || len(res.services.Items) != 1 {
+		t.Errorf("want 1 RBAC policy and 1 service but got %d and %d", len(res.rbac), len(res.services.Items))
+	}
+	if want := []string{"bar", "default", "empty", "istio-control"}; !reflect.DeepEqual(res.namespaces, want) {
+		t.Errorf("want namespaces %v but got %v", want, res.namespaces)
+	}
+	if res.rootNamespace != "istio-config" || istioNamespace != "istio-control" {
+		t.Errorf("want root namespace istio-config in istio-control but got %s in %s", res.rootNamespace, istioNamespace)
+	}
+
+	if _, err := loadFiles([]string{filepath.Join(dir, "not-found.yaml")}); err == nil {
+		t.Errorf("want error for the input not found")
+	}
+
+	// The input - reads from stdin together with the other inputs.
+	stdin, err := os.Open(filepath.Join(dir, "k8s/services.json"))
+	if err != nil {
+		t.Fatalf("failed to open stdin: %v", err)
+	}
+	defer stdin.Close()
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = stdin
+	res, err = loadFiles([]string{filepath.Join(dir, "policies.yaml"), stdinInput})
+	if err != nil {
+		t.Fatalf("want no error but got %v", err)
+	}
+	if len(res.policies) != 2 || len(res.services.Items) != 1 {
+		t.Errorf("want 2 policies and 1 service from stdin but got %d and %d", len(res.policies), len(res.services.Items))
+	}
+}
@@ -3,16 +3,21 @@ package main
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/istio-ecosystem/security-policy-migrate/converter"
+	corev1 "k8s.io/api/core/v1"
 	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
@@ -22,9 +27,16 @@ import (
 )
 
 const (
-	meshConfigMapKey  = "mesh"
-	meshConfigMapName = "istio"
-	istioNamespace    = "istio-system"
+	meshConfigMapKey      = "mesh"
+	meshConfigMapPrefix   = "istio"
+	defaultIstioNamespace = "istio-system"
+	defaultRevision       = "default"
+	revisionLabel         = "istio.io/rev"
+	istiodSelector        = "app=istiod"
+	// serviceFetchConcurrency is the maximum number of concurrent requests to get the referenced services.
+	serviceFetchConcurrency = 16
+	// listPageSize is the maximum number of objects returned in each page of the list requests.
+	listPageSize = 500
 )
 
 var (
@@ -38,12 +50,39 @@ var (
 		{Group: "rbac.istio.io", Version: "v1alpha1", Resource: "servicerolebindings"},
 		{Group: "rbac.istio.io", Version: "v1alpha1", Resource: "serviceroles"},
 	}
+	gvrDestinationRule = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1alpha3", Resource: "destinationrules"}
+	// clusterScoped includes the cluster scoped alpha resources that apply to all namespaces.
+	clusterScoped = map[string]bool{"meshpolicies": true, "rbacconfigs": true, "clusterrbacconfigs": true}
+	// alphaResources maps the kind of the alpha policies to the resource name.
+	alphaResources = map[string]string{
+		"Policy":             "policies",
+		"MeshPolicy":         "meshpolicies",
+		"RbacConfig":         "rbacconfigs",
+		"ClusterRbacConfig":  "clusterrbacconfigs",
+		"ServiceRoleBinding": "servicerolebindings",
+		"ServiceRole":        "serviceroles",
+	}
+	// betaResources maps the kind of the beta policies (and the EnvoyFilter generated with --preserve-401) to the
+	// resource name.
+	betaResources = map[string]string{
+		"PeerAuthentication":    "peerauthentications",
+		"RequestAuthentication": "requestauthentications",
+		"AuthorizationPolicy":   "authorizationpolicies",
+		"EnvoyFilter":           "envoyfilters",
+	}
+	// betaGVKs includes the kinds of the objects generated by the tool.
+	betaGVKs = []schema.GroupVersionKind{converter.PeerAuthenticationGVK, converter.RequestAuthenticationGVK,
+		converter.AuthorizationPolicyGVK, converter.EnvoyFilterGVK}
 )
 
 type kubeClient struct {
 	dynamicClient dynamic.Interface
 	kubeClient    *kubernetes.Clientset
 	rootNamespace string
+	// meshConfig is the mesh wide authentication settings in the mesh config map, nil if not found.
+	meshConfig *converter.MeshConfig
+	// meshConfigMap is the istio mesh config map, nil if not found.
+	meshConfigMap *corev1.ConfigMap
 }
 
 func newKubeClient(kubeconfig, configContext string) (*kubeClient, error) {
@@ -68,143 +107,406 @@ func newKubeClient(kubeconfig, configContext string) (*kubeClient, error) {
 	}
 
 	kc := &kubeClient{dynamicClient: dynamic.NewForConfigOrDie(config), kubeClient: kubernetes.NewForConfigOrDie(config)}
+	if err := kc.discoverControlPlane(); err != nil {
+		return nil, err
+	}
 	if err := kc.setRootnamespace(); err != nil {
 		return nil, err
 	}
 	return kc, nil
 }
 
+// meshConfigMapName returns the name of the mesh config map of the revision.
+func meshConfigMapName() string {
+	if revision == "" || revision == defaultRevision {
+		return meshConfigMapPrefix
+	}
+	return meshConfigMapPrefix + "-" + revision
+}
+
+// discoverControlPlane finds the namespace and revision of the control plane from the istiod pods in the cluster if
+// they are not set with the flags. The default namespace and revision are used if no istiod pod is found (e.g. the
+// control plane without istiod), an error is returned if multiple control planes are found.
+func (kc *kubeClient) discoverControlPlane() error {
+	if istioNamespace != "" && revision != "" {
+		return nil
+	}
+	// The empty istioNamespace lists the pods in all namespaces.
+	pods, err := kc.kubeClient.CoreV1().Pods(istioNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: istiodSelector})
+	if err != nil {
+		return fmt.Errorf("failed to list istiod pods: %w", err)
+	}
+	found := map[string]bool{}
+	var planes []string
+	namespace, rev := istioNamespace, revision
+	for _, pod := range pods.Items {
+		podRevision := pod.Labels[revisionLabel]
+		if podRevision == "" {
+			podRevision = defaultRevision
+		}
+		key := fmt.Sprintf("%s (revision %s)", pod.Namespace, podRevision)
+		if (revision != "" && podRevision != revision) || found[key] {
+			continue
+		}
+		found[key] = true
+		planes = append(planes, key)
+		namespace, rev = pod.Namespace, podRevision
+	}
+
+	switch len(planes) {
+	case 0:
+		if istioNamespace == "" {
+			istioNamespace = defaultIstioNamespace
+		}
+		if revision == "" {
+			revision = defaultRevision
+		}
+		log.Printf("could not find istiod, using control plane in %s (revision %s)", istioNamespace, revision)
+	case 1:
+		istioNamespace, revision = namespace, rev
+		log.Printf("found control plane in %s", planes[0])
+	default:
+		return fmt.Errorf("found multiple control planes: %s, use --istio-namespace and --revision to select the one "+
+			"that will enforce the beta policies", strings.Join(planes, ", "))
+	}
+	return nil
+}
+
 func (kc *kubeClient) hasIstioNamespace() bool {
 	ns, err := kc.kubeClient.CoreV1().Namespaces().Get(context.TODO(), istioNamespace, metav1.GetOptions{})
 	return ns != nil && err == nil
 }
 
 func (kc *kubeClient) setRootnamespace() error {
-	meshConfigMap, err := kc.kubeClient.CoreV1().ConfigMaps(istioNamespace).Get(context.TODO(), meshConfigMapName, metav1.GetOptions{})
+	meshConfigMap, err := kc.kubeClient.CoreV1().ConfigMaps(istioNamespace).Get(context.TODO(), meshConfigMapName(), metav1.GetOptions{})
 	if err != nil {
 		if kerr.IsNotFound(err) {
-			log.Printf("could not find mesh config %s, using %s as default root namespace", meshConfigMapName, istioNamespace)
+			log.Printf("could not find mesh config %s/%s, using %s as default root namespace", istioNamespace, meshConfigMapName(), istioNamespace)
 			kc.rootNamespace = istioNamespace
 			return nil
 		}
 		return fmt.Errorf("failed to get meshconfig: %w", err)
 	}
-	configYaml, ok := meshConfigMap.Data[meshConfigMapKey]
+	rootNamespace, meshConfig, err := parseMeshConfig(meshConfigMap.Namespace, meshConfigMap.Name, meshConfigMap.Data)
+	if err != nil {
+		return err
+	}
+	kc.rootNamespace = rootNamespace
+	kc.meshConfig = meshConfig
+	kc.meshConfigMap = meshConfigMap
+	return nil
+}
+
+// parseMeshConfig returns the root namespace and the mesh wide authentication settings from the data of the mesh
+// config map, the root namespace defaults to the namespace of the mesh config map.
+func parseMeshConfig(namespace, name string, data map[string]string) (string, *converter.MeshConfig, error) {
+	configYaml, ok := data[meshConfigMapKey]
 	if !ok {
-		return fmt.Errorf("missing config map key %q", meshConfigMapKey)
+		return "", nil, fmt.Errorf("missing config map key %q", meshConfigMapKey)
 	}
 	jsonData, err := yaml.YAMLToJSON([]byte(configYaml))
 	if err != nil {
-		return fmt.Errorf("failed converting YAML to JSON: %w", err)
+		return "", nil, fmt.Errorf("failed converting YAML to JSON: %w", err)
 	}
 	jsonObject := map[string]interface{}{}
 	if err := json.Unmarshal(jsonData, &jsonObject); err != nil {
-		return fmt.Errorf("failed unmarshaling JSON object: %w", err)
+		return "", nil, fmt.Errorf("failed unmarshaling JSON object: %w", err)
 	}
-	if val, found := jsonObject["rootNamespace"]; found && val != nil {
-		if v, ok := val.(string); ok && v != "" {
-			kc.rootNamespace = v
-			log.Printf("found root namespace: %s", kc.rootNamespace)
+
+	meshConfig := &converter.MeshConfig{Namespace: namespace, Name: name}
+	if val, found := jsonObject["authPolicy"]; found && val != nil {
+		v, ok := val.(string)
+		if !ok || (v != converter.AuthPolicyNone && v != converter.AuthPolicyMutualTLS) {
+			return "", nil, fmt.Errorf("unsupported authPolicy %v in mesh config", val)
 		}
+		log.Printf("found authPolicy: %s", v)
+		meshConfig.AuthPolicy = v
 	}
-	if kc.rootNamespace == "" {
-		log.Printf("root namespace not set, using %s as default", istioNamespace)
-		kc.rootNamespace = istioNamespace
+	if val, found := jsonObject["enableAutoMtls"]; found && val != nil {
+		v, ok := val.(bool)
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported enableAutoMtls %v in mesh config", val)
+		}
+		log.Printf("found enableAutoMtls: %t", v)
+		meshConfig.EnableAutoMtls = &v
 	}
 
-	return nil
+	if val, found := jsonObject["rootNamespace"]; found && val != nil {
+		if v, ok := val.(string); ok && v != "" {
+			log.Printf("found root namespace: %s", v)
+			return v, meshConfig, nil
+		}
+	}
+	log.Printf("root namespace not set, using %s as default", namespace)
+	return namespace, meshConfig, nil
 }
 
-func (kc *kubeClient) convert() error {
+// load reads all resources needed by the conversion from the cluster. The resource that fails to list is skipped,
+// unless strict is set and the failure is not caused by the missing CRD, e.g. the backup must not miss any resource.
+func (kc *kubeClient) load(strict bool) (*resources, error) {
 	if !kc.hasIstioNamespace() {
-		return fmt.Errorf("could not find %s namespace", istioNamespace)
+		return nil, fmt.Errorf("could not find %s namespace", istioNamespace)
 	}
 
-	// TODO: change to get specific service instead of listing all services.
-	services, err := kc.kubeClient.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to list services: %w", err)
+	res := &resources{rootNamespace: kc.rootNamespace, meshConfig: kc.meshConfig}
+	list := func(gvr schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+		objectList, err := kc.listResources(gvr)
+		if err == nil {
+			return objectList.Items, nil
+		}
+		if strict && !kerr.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return nil, fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+		}
+		log.Printf("skipped resource %s: %v", gvr.Resource, err)
+		return nil, nil
 	}
-	cvt := converter.NewConverter(kc.rootNamespace, services)
-	hasError := false
-	betaPolicyOutput := map[string]*strings.Builder{}
 	for _, gvr := range gvrPolicies {
-		objectList, err := kc.listResources(gvr)
+		items, err := list(gvr)
 		if err != nil {
-			log.Printf("skipped resource %s: %v", gvr.Resource, err)
-			continue
+			return nil, err
 		}
-		for _, item := range objectList.Items {
-			policy, err := converter.ConvertToPolicy(item)
+		res.policies = append(res.policies, items...)
+	}
+	for _, gvr := range gvrRbac {
+		items, err := list(gvr)
+		if err != nil {
+			return nil, err
+		}
+		res.rbac = append(res.rbac, items...)
+	}
+	items, err := list(gvrDestinationRule)
+	if err != nil {
+		return nil, err
+	}
+	res.destinationRules = items
+
+	// Only load the services referenced by the policies, listing all services is too slow in a large cluster.
+	refs, err := referencedServices(res)
+	if err != nil {
+		return nil, err
+	}
+	if res.services, err = kc.getServices(refs); err != nil {
+		return nil, err
+	}
+	if res.namespaces, err = kc.listNamespaces(); err != nil {
+		return nil, err
+	}
+	if res.pods, err = kc.listPods(res.services, res.policies); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// getServices lists all services in the referenced namespaces and gets the other referenced services concurrently,
+// the service not found is skipped and reported later in the conversion.
+func (kc *kubeClient) getServices(refs *converter.ServiceReferences) (*corev1.ServiceList, error) {
+	ret := &corev1.ServiceList{}
+	var listed []string
+	for ns := range refs.Namespaces {
+		listed = append(listed, ns)
+	}
+	sort.Strings(listed)
+	for _, ns := range listed {
+		opts := metav1.ListOptions{Limit: listPageSize}
+		for {
+			serviceList, err := kc.kubeClient.CoreV1().Services(ns).List(context.TODO(), opts)
 			if err != nil {
-				return fmt.Errorf("failed to convert resource to authentication policy: %v", err)
+				return nil, fmt.Errorf("failed to list services in namespace %s: %w", ns, err)
 			}
-			output, summary := cvt.Convert(policy)
-			if cnt := len(summary.Errors); cnt != 0 {
-				errorOutput := fmt.Sprintf("\n\t* %s", strings.Join(summary.Errors, "\n\t* "))
-				log.Printf("FAILED  converting policy %s/%s, found %d errors: %s", item.GetNamespace(), item.GetName(), cnt, errorOutput)
-				hasError = true
-			} else {
-				log.Printf("SUCCESS converting policy %s/%s", item.GetNamespace(), item.GetName())
-				for _, out := range output {
-					key := "all"
-					if perNamespace != "" {
-						key = out.Namespace
-					}
-					if _, ok := betaPolicyOutput[key]; !ok {
-						betaPolicyOutput[key] = &strings.Builder{}
-					}
-					betaPolicyOutput[key].WriteString(out.ToYAML())
-				}
+			ret.Items = append(ret.Items, serviceList.Items...)
+			if serviceList.Continue == "" {
+				break
 			}
+			opts.Continue = serviceList.Continue
 		}
 	}
 
-	var rbacResources []string
-	for _, gvr := range gvrRbac {
-		objectList, err := kc.listResources(gvr)
+	var names []string
+	for key := range refs.Services {
+		if !refs.Namespaces[strings.SplitN(key, "/", 2)[0]] {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	services := make([]*corev1.Service, len(names))
+	errs := make([]error, len(names))
+	sem := make(chan struct{}, serviceFetchConcurrency)
+	var wg sync.WaitGroup
+	for i, key := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, key string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			parts := strings.SplitN(key, "/", 2)
+			svc, err := kc.kubeClient.CoreV1().Services(parts[0]).Get(context.TODO(), parts[1], metav1.GetOptions{})
+			switch {
+			case kerr.IsNotFound(err):
+			case err != nil:
+				errs[i] = fmt.Errorf("failed to get service %s: %w", key, err)
+			default:
+				services[i] = svc
+			}
+		}(i, key)
+	}
+	wg.Wait()
+	for i := range names {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if services[i] != nil {
+			ret.Items = append(ret.Items, *services[i])
+		}
+	}
+	log.Printf("loaded %d services referenced by the policies from %d namespaces and %d names", len(ret.Items),
+		len(listed), len(names))
+	return ret, nil
+}
+
+// listNamespaces returns all namespaces in the cluster, or the namespaces given by --namespace if set.
+func (kc *kubeClient) listNamespaces() ([]string, error) {
+	if len(namespaces) != 0 {
+		return namespaces, nil
+	}
+	var ret []string
+	opts := metav1.ListOptions{Limit: listPageSize}
+	for {
+		namespaceList, err := kc.kubeClient.CoreV1().Namespaces().List(context.TODO(), opts)
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("failed to list namespaces: %w", err)
+		}
+		for _, ns := range namespaceList.Items {
+			ret = append(ret, ns.Name)
+		}
+		if namespaceList.Continue == "" {
+			return ret, nil
+		}
+		opts.Continue = namespaceList.Continue
+	}
+}
+
+// listPods lists the pods selected by the services that use named target port or are targeted by the authentication
+// policies, the pods are used to resolve the named target port to the container port and to detect the overlapping
+// PeerAuthentications.
+func (kc *kubeClient) listPods(services *corev1.ServiceList, policies []unstructured.Unstructured) ([]corev1.Pod, error) {
+	targets := map[string]bool{}
+	for _, item := range policies {
+		policy, err := converter.ConvertToPolicy(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert resource to authentication policy: %v", err)
 		}
-		for _, item := range objectList.Items {
-			rbacResources = append(rbacResources, fmt.Sprintf("%s: %s/%s", item.GetKind(), item.GetNamespace(), item.GetName()))
+		for _, target := range policy.Policy.Targets {
+			targets[policy.Namespace+"/"+target.Name] = true
 		}
 	}
-	if len(rbacResources) != 0 {
-		errorOutput := fmt.Sprintf("\n\t* %s", strings.Join(rbacResources, "\n\t* "))
-		log.Printf("FAILED  found %d RBAC resources, this tool only supports converting authentication policy, "+
-			"check https://istio.io/latest/blog/2019/v1beta1-authorization-policy/#migration-from-the-v1alpha1-policy for converting RBAC resources manually: %s", len(rbacResources), errorOutput)
-		hasError = true
+
+	var ret []corev1.Pod
+	found := map[string]bool{}
+	for _, svc := range services.Items {
+		if len(svc.Spec.Selector) == 0 || (!hasNamedTargetPort(&svc) && !targets[svc.Namespace+"/"+svc.Name]) {
+			continue
+		}
+		selector := labels.SelectorFromSet(svc.Spec.Selector).String()
+		pods, err := kc.kubeClient.CoreV1().Pods(svc.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods for service %s/%s: %w", svc.Namespace, svc.Name, err)
+		}
+		for _, pod := range pods.Items {
+			if key := pod.Namespace + "/" + pod.Name; !found[key] {
+				found[key] = true
+				ret = append(ret, pod)
+			}
+		}
 	}
+	return ret, nil
+}
 
-	if hasError {
-		if ignoreError {
-			log.Printf("Found errors but ignored with --ignore-error, the converted policies may not work as expected")
-		} else {
-			// TODO: add a link to the istio.io conversion documentation.
-			return fmt.Errorf("conversion failed, found errors during conversion, please fix errors and re-run the tool again")
+func hasNamedTargetPort(svc *corev1.Service) bool {
+	for _, port := range svc.Spec.Ports {
+		if port.TargetPort.Type == intstr.String {
+			return true
 		}
 	}
+	return false
+}
 
-	if len(betaPolicyOutput) == 0 {
-		fmt.Printf("generated 0 beta policies")
-		return nil
+// betaResource returns the resource of the beta policy kind.
+func betaResource(gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
+	resource, found := betaResources[gvk.Kind]
+	if !found {
+		return schema.GroupVersionResource{}, fmt.Errorf("unsupported beta policy kind %s", gvk.Kind)
 	}
-	if perNamespace != "" {
-		for ns, out := range betaPolicyOutput {
-			filename := fmt.Sprintf("%s/ns-%s.yaml", perNamespace, ns)
-			log.Printf("Writing to %s for namespace %s", filename, ns)
-			err := ioutil.WriteFile(filename, []byte(out.String()), 0644)
+	return gvk.GroupVersion().WithResource(resource), nil
+}
+
+// listBeta lists the beta policies in the cluster, the kinds without CRD installed are skipped.
+func (kc *kubeClient) listBeta() ([]*converter.ObjectStruct, error) {
+	var ret []*converter.ObjectStruct
+	for _, gvk := range betaGVKs {
+		// List in the output API version so that the existing objects are compared to the generated ones.
+		gvr, err := betaResource(converter.OutputGVK(gvk, outputAPIVersion))
+		if err != nil {
+			return nil, err
+		}
+		list, err := kc.dynamicClient.Resource(gvr).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+		if kerr.IsNotFound(err) {
+			log.Printf("skipped resource %s: %v", gvr.Resource, err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+		}
+		for _, item := range list.Items {
+			data, err := item.MarshalJSON()
 			if err != nil {
-				return fmt.Errorf("write to %s failed: %v", filename, err)
+				return nil, fmt.Errorf("failed to marshal %s %s/%s: %w", item.GetKind(), item.GetNamespace(), item.GetName(), err)
 			}
+			obj := &converter.ObjectStruct{}
+			if err := json.Unmarshal(data, obj); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal %s %s/%s: %w", item.GetKind(), item.GetNamespace(), item.GetName(), err)
+			}
+			ret = append(ret, obj)
 		}
-	} else {
-		fmt.Printf(betaPolicyOutput["all"].String())
 	}
-	return nil
+	return ret, nil
+}
+
+// alphaResource returns the resource of the alpha policy kind.
+func alphaResource(gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
+	resource, found := alphaResources[gvk.Kind]
+	if !found || (gvk.Group != "authentication.istio.io" && gvk.Group != "rbac.istio.io") {
+		return schema.GroupVersionResource{}, fmt.Errorf("unsupported alpha policy kind %s", gvk.Kind)
+	}
+	return gvk.GroupVersion().WithResource(resource), nil
 }
 
+// listResources lists the resources in all namespaces, the namespaced resources are only listed in the namespaces
+// given by --namespace if set. The DestinationRules are always listed in all namespaces as they could configure the
+// services in scope from any namespace, the ServiceRoles are also listed in the root namespace as they could be
+// referenced by the ServiceRoleBindings in any namespace.
 func (kc *kubeClient) listResources(gvr schema.GroupVersionResource) (*unstructured.UnstructuredList, error) {
-	return kc.dynamicClient.Resource(gvr).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if len(namespaces) == 0 || clusterScoped[gvr.Resource] || gvr == gvrDestinationRule {
+		return kc.dynamicClient.Resource(gvr).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	}
+	listed := append([]string{}, namespaces...)
+	if gvr.Resource == "serviceroles" {
+		found := false
+		for _, ns := range namespaces {
+			found = found || ns == kc.rootNamespace
+		}
+		if !found {
+			listed = append(listed, kc.rootNamespace)
+		}
+	}
+	ret := &unstructured.UnstructuredList{}
+	for _, ns := range listed {
+		objectList, err := kc.dynamicClient.Resource(gvr).Namespace(ns).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		ret.Items = append(ret.Items, objectList.Items...)
+	}
+	return ret, nil
 }
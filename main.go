@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
 	"github.com/spf13/cobra"
 )
 
@@ -12,7 +13,33 @@ var (
 	configContext string
 	ignoreError   bool
 	perNamespace  string
-	version       string
+	inputFiles    []string
+	reportFormat  string
+	reportFile    string
+	suppressCodes []string
+	assumeYes     bool
+	snapshotFile  string
+	rollbackRunID string
+	restoreFile   string
+	backupFile    string
+	overwrite     bool
+	explainOutput string
+	// istioNamespace and revision identify the control plane, they are discovered if not set with the flags.
+	istioNamespace string
+	revision       string
+	// namespaces, excludeNamespaces and policySelector restrict the alpha policies converted by the tool.
+	namespaces        []string
+	excludeNamespaces []string
+	policySelector    string
+	// preserve401 generates the EnvoyFilters returning 401 for the request without JWT as in alpha.
+	preserve401 bool
+	// shadow generates the AuthorizationPolicies requiring JWT in dry-run mode, promoteRunID restricts the promote
+	// command to a single run.
+	shadow       bool
+	promoteRunID string
+	// outputAPIVersion is the version of the generated security.istio.io objects.
+	outputAPIVersion string
+	version          string
 )
 
 func main() {
@@ -33,23 +60,30 @@ func rootCmd(args []string) *cobra.Command {
 		Example: `
 # Convert the v1alpha1 authentication policy in the current cluster and output the beta policy to beta-policies.yaml:
 ./convert > beta-policy.yaml
+
+# Convert the v1alpha1 authentication policy in local files without accessing the cluster:
+./convert --input alpha-policy.yaml --input k8s-services/ > beta-policy.yaml
 `,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return validateReport(reportFormat, reportFile)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if kubeconfig != "" {
-				log.Printf("configured kubeconfig: %s", kubeconfig)
-			}
-			if configContext != "" {
-				log.Printf("configured context: %s", configContext)
-			}
-			client, err := newKubeClient(kubeconfig, configContext)
+			res, err := loadResources()
 			if err != nil {
-				log.Fatalf("failed to create kube client: %v", err)
+				return err
 			}
-			return client.convert()
+			return convert(res)
 		},
 		Version: version,
 	}
 	cmd.SetArgs(args)
+	cmd.AddCommand(verifyCmd())
+	cmd.AddCommand(applyCmd())
+	cmd.AddCommand(rollbackCmd())
+	cmd.AddCommand(backupCmd())
+	cmd.AddCommand(diffCmd())
+	cmd.AddCommand(explainCmd())
+	cmd.AddCommand(promoteCmd())
 	cmd.PersistentFlags().StringVarP(&kubeconfig, "kubeconfig", "c", "",
 		"kubernetes configuration file")
 	cmd.PersistentFlags().StringVar(&configContext, "context", "",
@@ -58,5 +92,55 @@ func rootCmd(args []string) *cobra.Command {
 		"the conversion and still generate the converted beta policies, use with caution as the converted policies may not work as expected")
 	cmd.PersistentFlags().StringVarP(&perNamespace, "per-namespace", "", "", "store policies per-namespace "+
 		"so that you could verify and apply the generated policies incrementally in separate yaml file per-namespace")
+	cmd.PersistentFlags().StringSliceVarP(&inputFiles, "input", "f", nil, "read the v1alpha1 policies, services and "+
+		"the istio mesh config map from the given YAML files or directories (use - for stdin) instead of the cluster")
+	cmd.PersistentFlags().StringVar(&reportFormat, "report", "", "output a machine-readable conversion report "+
+		"in the given format (json or yaml) including the status, generated objects, errors and warnings of each alpha policy")
+	cmd.PersistentFlags().StringVar(&reportFile, "report-file", "", "write the report to the given file, "+
+		"required with --report")
+	cmd.PersistentFlags().StringSliceVar(&suppressCodes, "suppress", nil, "suppress the issues with the given "+
+		"code (e.g. SERVICE_NOT_FOUND) for all policies, or only for a single policy with namespace/name:CODE "+
+		"(name:CODE for MeshPolicy and ClusterRbacConfig)")
+	cmd.PersistentFlags().StringVar(&istioNamespace, "istio-namespace", "", "the namespace of the control plane that "+
+		"will enforce the beta policies, discovered from the istiod pods (or the mesh config map in the input) if not set")
+	cmd.PersistentFlags().StringVar(&revision, "revision", "", "the revision of the control plane, the mesh config map "+
+		"istio-<revision> is used for a non-default revision, discovered from the istiod pods if not set")
+	cmd.PersistentFlags().StringSliceVar(&namespaces, "namespace", nil, "only convert the alpha policies in the given "+
+		"namespaces and generate the beta policies in these namespaces, the policies in other namespaces and the mesh "+
+		"level policies are still read to resolve the precedence")
+	cmd.PersistentFlags().StringSliceVar(&excludeNamespaces, "exclude-namespace", nil, "do not convert the alpha "+
+		"policies in the given namespaces or generate the beta policies in these namespaces")
+	cmd.PersistentFlags().StringVarP(&policySelector, "selector", "l", "", "only convert the alpha policies matching "+
+		"the label selector (e.g. team=foo)")
+	cmd.PersistentFlags().BoolVar(&preserve401, "preserve-401", false, "also generate an EnvoyFilter for the "+
+		"workloads requiring JWT so that the request without JWT is rejected with 401 \"Origin authentication failed.\" "+
+		"as in alpha instead of 403 \"RBAC: access denied\", requires Istio 1.8 or later")
+	cmd.PersistentFlags().BoolVar(&shadow, "shadow", false, "generate the DENY AuthorizationPolicies requiring JWT "+
+		"with the istio.io/dry-run annotation so that the requests they would deny are only logged, enforce them later "+
+		"with the promote command, requires Istio 1.10 or later")
+	cmd.PersistentFlags().StringVar(&outputAPIVersion, "output-api-version", converter.APIVersionV1beta1, "the version "+
+		"of the generated security.istio.io policies (v1beta1 or v1), in v1 the RequestAuthentications and "+
+		"AuthorizationPolicies for the services labeled with istio.io/use-waypoint are also attached to the waypoint "+
+		"with targetRefs in a copy suffixed with -waypoint, the Gateway API gateways are not detected and always use "+
+		"the workload selector, requires Istio 1.22 or later")
 	return cmd
 }
+
+// loadResources loads the resources from the input files if specified, otherwise from the cluster.
+func loadResources() (*resources, error) {
+	if len(inputFiles) != 0 {
+		log.Printf("reading resources from input: %v", inputFiles)
+		return loadFiles(inputFiles)
+	}
+	if kubeconfig != "" {
+		log.Printf("configured kubeconfig: %s", kubeconfig)
+	}
+	if configContext != "" {
+		log.Printf("configured context: %s", configContext)
+	}
+	client, err := newKubeClient(kubeconfig, configContext)
+	if err != nil {
+		log.Fatalf("failed to create kube client: %v", err)
+	}
+	return client.load(false)
+}
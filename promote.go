@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func promoteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "promote",
+		Short: "Promote the AuthorizationPolicies generated in dry-run mode with --shadow to enforce them.",
+		Long: `Promote removes the istio.io/dry-run annotation from the AuthorizationPolicies generated with --shadow, so that
+the request without JWT is rejected as in alpha. Before promoting, check the proxy logs or metrics (the
+shadow_effective_policy_id and shadow_engine_result) during the observation window to make sure no expected request
+would be denied. Only the AuthorizationPolicies generated by the tool are promoted, optionally restricted to a single
+run with --run and to the namespaces with --namespace and --exclude-namespace.`,
+		Example: `
+# Promote the AuthorizationPolicies in dry-run mode generated in the run 20200601-120000-x7k2f:
+./convert promote --run 20200601-120000-x7k2f
+
+# Promote the AuthorizationPolicies in dry-run mode in the namespace foo without confirmation:
+./convert promote --namespace foo --yes
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newKubeClient(kubeconfig, configContext)
+			if err != nil {
+				log.Fatalf("failed to create kube client: %v", err)
+			}
+			return promote(client, promoteRunID, os.Stdin)
+		},
+	}
+	cmd.Flags().StringVar(&promoteRunID, "run", "", "only promote the AuthorizationPolicies generated in the given run")
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "promote the AuthorizationPolicies without confirmation")
+	return cmd
+}
+
+func promote(client *kubeClient, runID string, confirmInput io.Reader) error {
+	sc, err := newScope()
+	if err != nil {
+		return err
+	}
+	items, err := client.dryRunPolicies(runID, sc)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		log.Printf("found 0 AuthorizationPolicies in dry-run mode to promote")
+		return nil
+	}
+	if !assumeYes && !confirmPromote(bufio.NewReader(confirmInput), items) {
+		return fmt.Errorf("promotion is cancelled")
+	}
+	for _, item := range items {
+		if err := client.promoteBeta(item); err != nil {
+			return err
+		}
+		log.Printf("PROMOTED %s", objectReference(item))
+	}
+	log.Printf("promoted %d AuthorizationPolicies", len(items))
+	return nil
+}
+
+// confirmPromote asks the user to confirm promoting the AuthorizationPolicies.
+func confirmPromote(reader *bufio.Reader, items []*unstructured.Unstructured) bool {
+	fmt.Fprintf(os.Stderr, "The following AuthorizationPolicies in dry-run mode will be enforced:\n")
+	for _, item := range items {
+		fmt.Fprintf(os.Stderr, "  - promote %s\n", objectReference(item))
+	}
+	fmt.Fprintf(os.Stderr, "Promote %d AuthorizationPolicies? [y/N]: ", len(items))
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// dryRunPolicies returns the AuthorizationPolicies in dry-run mode generated by the tool, in the run if runID is not
+// empty and in the namespaces in scope.
+func (kc *kubeClient) dryRunPolicies(runID string, sc *scope) ([]*unstructured.Unstructured, error) {
+	gvr, err := betaResource(converter.AuthorizationPolicyGVK)
+	if err != nil {
+		return nil, err
+	}
+	selector := converter.RunLabel
+	if runID != "" {
+		selector = fmt.Sprintf("%s=%s", converter.RunLabel, runID)
+	}
+	list, err := kc.dynamicClient.Resource(gvr).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+	}
+	var ret []*unstructured.Unstructured
+	for i := range list.Items {
+		item := &list.Items[i]
+		if item.GetAnnotations()[converter.DryRunAnnotation] != "true" || !sc.includesNamespace(item.GetNamespace()) {
+			continue
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+// promoteBeta removes the dry-run annotation from the AuthorizationPolicy.
+func (kc *kubeClient) promoteBeta(item *unstructured.Unstructured) error {
+	gvr, err := betaResource(item.GroupVersionKind())
+	if err != nil {
+		return err
+	}
+	item = item.DeepCopy()
+	annotations := item.GetAnnotations()
+	delete(annotations, converter.DryRunAnnotation)
+	if comment, ok := annotations[converter.ConvertAnnotation]; ok {
+		annotations[converter.ConvertAnnotation] = strings.TrimSuffix(comment, converter.DryRunComment)
+	}
+	item.SetAnnotations(annotations)
+	if _, err := kc.dynamicClient.Resource(gvr).Namespace(item.GetNamespace()).Update(context.TODO(), item, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to promote %s: %w", objectReference(item), err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+	"k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/yaml"
+)
+
+// Status of the conversion of a single alpha policy.
+const (
+	statusSuccess    = "SUCCESS"
+	statusFailed     = "FAILED"
+	statusOutOfScope = "OUT_OF_SCOPE"
+
+	// Status of the verification of a single alpha policy.
+	statusVerified = "VERIFIED"
+	statusMismatch = "MISMATCH"
+)
+
+// report is the machine-readable conversion report.
+type report struct {
+	GeneratedAt string          `json:"generatedAt"`
+	Summary     reportSummary   `json:"summary"`
+	Policies    []*policyReport `json:"policies"`
+}
+
+type reportSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Outputs   int `json:"outputs"`
+	// OutOfScope is the number of alpha policies excluded by --namespace, --exclude-namespace and --selector.
+	OutOfScope int `json:"outOfScope,omitempty"`
+}
+
+// policyReport is the conversion result of a single alpha policy.
+type policyReport struct {
+	Kind      string                      `json:"kind"`
+	Namespace string                      `json:"namespace,omitempty"`
+	Name      string                      `json:"name,omitempty"`
+	Status    string                      `json:"status"`
+	Outputs   []converter.ObjectReference `json:"outputs,omitempty"`
+	Errors    []*converter.Issue          `json:"errors,omitempty"`
+	Warnings  []*converter.Issue          `json:"warnings,omitempty"`
+	// Suppressed includes the issues suppressed by --suppress or the suppress annotation.
+	Suppressed []*converter.Issue `json:"suppressed,omitempty"`
+	// OutOfScope includes the beta policies not generated as they are in the namespaces out of scope.
+	OutOfScope []converter.ObjectReference `json:"outOfScope,omitempty"`
+	// Verification is the result of the verify command.
+	Verification *converter.VerifyResult `json:"verification,omitempty"`
+
+	// outputs are resolved to Outputs when the report is written as the API version is set at the end.
+	outputs []*converter.OutputPolicy
+}
+
+func newReport() *report {
+	return &report{GeneratedAt: time.Now().UTC().Format(time.RFC3339)}
+}
+
+func (r *report) add(kind, namespace, name string, output []*converter.OutputPolicy, summary *converter.ResultSummary) {
+	policy := &policyReport{
+		Kind:       kind,
+		Namespace:  namespace,
+		Name:       name,
+		Status:     statusSuccess,
+		Errors:     summary.Errors,
+		Warnings:   summary.Warnings,
+		Suppressed: summary.Suppressed,
+	}
+	if len(summary.Errors) != 0 {
+		policy.Status = statusFailed
+		r.Summary.Failed++
+	} else {
+		policy.outputs = append([]*converter.OutputPolicy(nil), output...)
+		r.Summary.Succeeded++
+	}
+	r.Summary.Total++
+	r.Policies = append(r.Policies, policy)
+}
+
+// addIssues adds the issues found in the passes over all beta policies to the alpha policy, the policy is failed if
+// any error is added.
+func (r *report) addIssues(kind, namespace, name string, summary *converter.ResultSummary) {
+	for _, policy := range r.Policies {
+		if policy.Kind != kind || policy.Namespace != namespace || policy.Name != name {
+			continue
+		}
+		policy.Errors = append(policy.Errors, summary.Errors...)
+		policy.Warnings = append(policy.Warnings, summary.Warnings...)
+		policy.Suppressed = append(policy.Suppressed, summary.Suppressed...)
+		if len(summary.Errors) != 0 && policy.Status == statusSuccess {
+			policy.Status = statusFailed
+			r.Summary.Succeeded--
+			r.Summary.Failed++
+		}
+		return
+	}
+	r.add(kind, namespace, name, nil, summary)
+}
+
+// addOutput adds the beta policy generated from the source alpha policy after the conversion, e.g. the EnvoyFilter.
+func (r *report) addOutput(source converter.ObjectReference, output *converter.OutputPolicy) {
+	for _, policy := range r.Policies {
+		if policy.Kind == source.Kind && policy.Namespace == source.Namespace && policy.Name == source.Name {
+			policy.outputs = append(policy.outputs, output)
+			return
+		}
+	}
+}
+
+// addOutOfScope adds the alpha policy excluded by --namespace, --exclude-namespace and --selector.
+func (r *report) addOutOfScope(kind, namespace, name string) {
+	r.Policies = append(r.Policies, &policyReport{Kind: kind, Namespace: namespace, Name: name, Status: statusOutOfScope})
+	r.Summary.OutOfScope++
+	r.Summary.Total++
+}
+
+// dropOutput moves the beta policy generated from the source alpha policy to the out of scope outputs.
+func (r *report) dropOutput(source converter.ObjectReference, output *converter.OutputPolicy) {
+	for _, policy := range r.Policies {
+		if policy.Kind != source.Kind || policy.Namespace != source.Namespace || policy.Name != source.Name {
+			continue
+		}
+		refs := output.References()
+		for i, out := range policy.outputs {
+			if reflect.DeepEqual(out.References(), refs) {
+				policy.outputs = append(policy.outputs[:i], policy.outputs[i+1:]...)
+				break
+			}
+		}
+		policy.OutOfScope = append(policy.OutOfScope, refs...)
+		return
+	}
+}
+
+// addVerification adds the verification result of the alpha policy, the policy is failed if it could not be
+// converted, or it is mismatched if the verification found any difference or could not be completed.
+func (r *report) addVerification(kind, namespace, name string, output []*converter.OutputPolicy,
+	summary *converter.ResultSummary, result *converter.VerifyResult) {
+	r.add(kind, namespace, name, output, summary)
+	policy := r.Policies[len(r.Policies)-1]
+	if policy.Status == statusFailed {
+		return
+	}
+	policy.Verification = result
+	if len(result.Mismatches) != 0 || len(result.Errors) != 0 {
+		policy.Status = statusMismatch
+		r.Summary.Succeeded--
+		r.Summary.Failed++
+	} else {
+		policy.Status = statusVerified
+	}
+}
+
+// validateReport returns an error if the report format is not supported or the report file is not specified, it is
+// called before loading any resources so that an invalid flag does not waste the conversion.
+func validateReport(format, filename string) error {
+	if format == "" {
+		if filename != "" {
+			return fmt.Errorf("--report-file requires --report")
+		}
+		return nil
+	}
+	switch strings.ToLower(format) {
+	case "json", "yaml":
+	default:
+		return fmt.Errorf("unsupported report format %q, must be json or yaml", format)
+	}
+	if filename == "" {
+		return fmt.Errorf("--report requires --report-file as the stdout is used for the command output")
+	}
+	return nil
+}
+
+// write writes the report in the given format to the file.
+func (r *report) write(format, filename string) error {
+	r.Summary.Outputs = 0
+	for _, policy := range r.Policies {
+		policy.Outputs = nil
+		for _, out := range policy.outputs {
+			policy.Outputs = append(policy.Outputs, out.References()...)
+		}
+		r.Summary.Outputs += len(policy.Outputs)
+	}
+
+	var data []byte
+	var err error
+	switch strings.ToLower(format) {
+	case "json":
+		data, err = json.Marshal(r)
+		if err == nil {
+			data = append(data, '\n')
+		}
+	case "yaml":
+		data, err = yaml.Marshal(r)
+	default:
+		return fmt.Errorf("unsupported report format %q, must be json or yaml", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("write report to %s failed: %v", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateReport(t *testing.T) {
+	cases := []struct {
+		name      string
+		format    string
+		file      string
+		wantError string
+	}{
+		{name: "no-report"},
+		{name: "json", format: "json", file: "report.json"},
+		{name: "yaml-upper-case", format: "YAML", file: "report.yaml"},
+		{name: "no-file", format: "json", wantError: "--report requires --report-file"},
+		{name: "no-format", file: "report.json", wantError: "--report-file requires --report"},
+		{name: "unsupported-format", format: "xml", file: "report.xml", wantError: "unsupported report format \"xml\""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateReport(tc.format, tc.file)
+			if tc.wantError == "" {
+				if err != nil {
+					t.Fatalf("want no error but got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Fatalf("want error %q but got %v", tc.wantError, err)
+			}
+		})
+	}
+}
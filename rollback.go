@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+	"github.com/spf13/cobra"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func rollbackCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Delete the beta policies generated in a run and optionally restore the v1alpha1 policies from a snapshot.",
+		Long: `Rollback deletes exactly the beta policies generated in the given run, i.e. the policies recorded by the apply
+command and the policies labeled with the run ID (e.g. applied with kubectl from the convert output). The existing beta
+policies updated by the apply command are restored to the previous version instead of deleted. The v1alpha1 policies
+could be restored from the snapshot saved by the apply command.`,
+		Example: `
+# Delete the beta policies generated in the run 20200601-120000-x7k2f:
+./convert rollback --run 20200601-120000-x7k2f
+
+# Delete the beta policies generated in the run and restore the v1alpha1 policies from the snapshot:
+./convert rollback --run 20200601-120000-x7k2f --restore alpha-snapshot.yaml
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if rollbackRunID == "" {
+				return fmt.Errorf("--run is required")
+			}
+			client, err := newKubeClient(kubeconfig, configContext)
+			if err != nil {
+				log.Fatalf("failed to create kube client: %v", err)
+			}
+			return rollback(client, rollbackRunID, restoreFile, os.Stdin)
+		},
+	}
+	cmd.Flags().StringVar(&rollbackRunID, "run", "", "the run ID of the beta policies to delete")
+	cmd.Flags().StringVar(&restoreFile, "restore", "", "re-apply the v1alpha1 policies from the given snapshot file "+
+		"after the beta policies are deleted")
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "delete the beta policies without confirmation")
+	return cmd
+}
+
+func rollback(client *kubeClient, runID, restore string, confirmInput io.Reader) error {
+	var alphaItems []unstructured.Unstructured
+	if restore != "" {
+		// Read the snapshot first to fail early before anything is deleted.
+		items, err := readPath(restore)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if _, err := alphaResource(item.GroupVersionKind()); err != nil {
+				log.Printf("skipped unrelated resource %s: %s/%s in snapshot", item.GetKind(), item.GetNamespace(), item.GetName())
+				continue
+			}
+			alphaItems = append(alphaItems, item)
+		}
+	}
+
+	objects, previous, err := client.runObjects(runID)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 && len(previous) == 0 {
+		log.Printf("found 0 beta policies generated in run %s", runID)
+	} else {
+		if !assumeYes && !confirmRollback(bufio.NewReader(confirmInput), runID, objects, previous) {
+			return fmt.Errorf("rollback of run %s is cancelled", runID)
+		}
+		for _, ref := range objects {
+			if err := client.deleteBeta(ref); err != nil {
+				return err
+			}
+			log.Printf("DELETED  %s", ref)
+		}
+		for _, item := range previous {
+			if err := client.restoreBeta(item); err != nil {
+				return err
+			}
+			log.Printf("RESTORED %s", objectReference(item))
+		}
+	}
+	err = client.kubeClient.CoreV1().ConfigMaps(istioNamespace).Delete(context.TODO(), recordPrefix+runID, metav1.DeleteOptions{})
+	if err != nil && !kerr.IsNotFound(err) {
+		return fmt.Errorf("failed to delete the record of run %s: %w", runID, err)
+	}
+	log.Printf("deleted %d and restored %d beta policies applied in run %s", len(objects), len(previous), runID)
+
+	for _, item := range alphaItems {
+		if err := client.restoreAlpha(item); err != nil {
+			return err
+		}
+	}
+	if restore != "" {
+		log.Printf("restored %d v1alpha1 policies from %s", len(alphaItems), restore)
+	}
+	return nil
+}
+
+// confirmRollback asks the user to confirm deleting the beta policies of the run and restoring the updated ones.
+func confirmRollback(reader *bufio.Reader, runID string, objects []converter.ObjectReference, previous []*unstructured.Unstructured) bool {
+	fmt.Fprintf(os.Stderr, "The following beta policies applied in run %s will be rolled back:\n", runID)
+	for _, ref := range objects {
+		fmt.Fprintf(os.Stderr, "  - delete %s\n", ref)
+	}
+	for _, item := range previous {
+		fmt.Fprintf(os.Stderr, "  - restore %s\n", objectReference(item))
+	}
+	fmt.Fprintf(os.Stderr, "Delete %d and restore %d beta policies? [y/N]: ", len(objects), len(previous))
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// runObjects returns the beta policies generated in the run, including the policies recorded by the apply command that
+// still have the run label and the policies found with the run label. The policies updated by the apply command are
+// returned separately with the previous version to restore, they are not deleted.
+func (kc *kubeClient) runObjects(runID string) ([]converter.ObjectReference, []*unstructured.Unstructured, error) {
+	var ret []converter.ObjectReference
+	var previous []*unstructured.Unstructured
+	// found is keyed without the API version as the same object could be recorded in v1 and listed in v1beta1.
+	found := map[string]bool{}
+	add := func(ref converter.ObjectReference) {
+		if !found[ref.String()] {
+			found[ref.String()] = true
+			ret = append(ret, ref)
+		}
+	}
+	// stillInRun returns true if the recorded object still exists with the run label.
+	stillInRun := func(ref converter.ObjectReference) (bool, error) {
+		item, err := kc.getBeta(ref)
+		if kerr.IsNotFound(err) {
+			log.Printf("skipped %s recorded in run %s, already deleted", ref, runID)
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if item.GetLabels()[converter.RunLabel] != runID {
+			log.Printf("skipped %s recorded in run %s, it is no longer labeled with the run ID", ref, runID)
+			return false, nil
+		}
+		return true, nil
+	}
+
+	cm, err := kc.kubeClient.CoreV1().ConfigMaps(istioNamespace).Get(context.TODO(), recordPrefix+runID, metav1.GetOptions{})
+	if err != nil && !kerr.IsNotFound(err) {
+		return nil, nil, fmt.Errorf("failed to get the record of run %s: %w", runID, err)
+	}
+	if err == nil {
+		var recorded []converter.ObjectReference
+		if err := json.Unmarshal([]byte(cm.Data[recordObjectsKey]), &recorded); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse the record of run %s: %w", runID, err)
+		}
+		var recordedPrevious []map[string]interface{}
+		if data := cm.Data[recordPreviousKey]; data != "" {
+			if err := json.Unmarshal([]byte(data), &recordedPrevious); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse the record of run %s: %w", runID, err)
+			}
+		}
+		for _, obj := range recordedPrevious {
+			item := &unstructured.Unstructured{Object: obj}
+			ref := objectReference(item)
+			// Never delete the updated object even if it is no longer in the run.
+			found[ref.String()] = true
+			ok, err := stillInRun(ref)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				previous = append(previous, item)
+			}
+		}
+		for _, ref := range recorded {
+			ok, err := stillInRun(ref)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				add(ref)
+			}
+		}
+	}
+
+	selector := fmt.Sprintf("%s=%s", converter.RunLabel, runID)
+	for _, gvk := range betaGVKs {
+		gvr, err := betaResource(gvk)
+		if err != nil {
+			return nil, nil, err
+		}
+		list, err := kc.dynamicClient.Resource(gvr).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+		if kerr.IsNotFound(err) || meta.IsNoMatchError(err) {
+			// The kind without CRD installed (e.g. EnvoyFilter) has nothing to roll back.
+			log.Printf("skipped resource %s: %v", gvr.Resource, err)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list %s with run ID %s: %w", gvr.Resource, runID, err)
+		}
+		for i := range list.Items {
+			add(objectReference(&list.Items[i]))
+		}
+	}
+	return ret, previous, nil
+}
+
+func (kc *kubeClient) getBeta(ref converter.ObjectReference) (*unstructured.Unstructured, error) {
+	gvr, err := betaResource(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind))
+	if err != nil {
+		return nil, err
+	}
+	return kc.dynamicClient.Resource(gvr).Namespace(ref.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+}
+
+func (kc *kubeClient) deleteBeta(ref converter.ObjectReference) error {
+	gvr, err := betaResource(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind))
+	if err != nil {
+		return err
+	}
+	err = kc.dynamicClient.Resource(gvr).Namespace(ref.Namespace).Delete(context.TODO(), ref.Name, metav1.DeleteOptions{})
+	if err != nil && !kerr.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s: %w", ref, err)
+	}
+	return nil
+}
+
+// restoreBeta updates the beta policy back to the previous version recorded by the apply command.
+func (kc *kubeClient) restoreBeta(item *unstructured.Unstructured) error {
+	ref := objectReference(item)
+	current, err := kc.getBeta(ref)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", ref, err)
+	}
+	gvr, err := betaResource(item.GroupVersionKind())
+	if err != nil {
+		return err
+	}
+	item = item.DeepCopy()
+	item.SetResourceVersion(current.GetResourceVersion())
+	if _, err := kc.dynamicClient.Resource(gvr).Namespace(ref.Namespace).Update(context.TODO(), item, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", ref, err)
+	}
+	return nil
+}
+
+// restoreAlpha creates the v1alpha1 policy from the snapshot, the policy is skipped if it already exists.
+func (kc *kubeClient) restoreAlpha(item unstructured.Unstructured) error {
+	gvr, err := alphaResource(item.GroupVersionKind())
+	if err != nil {
+		return err
+	}
+	item = *item.DeepCopy()
+	for _, field := range []string{"resourceVersion", "uid", "selfLink", "creationTimestamp", "generation", "managedFields"} {
+		unstructured.RemoveNestedField(item.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(item.Object, "status")
+	_, err = kc.dynamicClient.Resource(gvr).Namespace(item.GetNamespace()).Create(context.TODO(), &item, metav1.CreateOptions{})
+	switch {
+	case kerr.IsAlreadyExists(err):
+		log.Printf("skipped restoring %s %s/%s, already exists", item.GetKind(), item.GetNamespace(), item.GetName())
+	case err != nil:
+		return fmt.Errorf("failed to restore %s %s/%s: %w", item.GetKind(), item.GetNamespace(), item.GetName(), err)
+	default:
+		log.Printf("RESTORED %s %s/%s", item.GetKind(), item.GetNamespace(), item.GetName())
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// scope restricts the alpha policies converted by the tool with --namespace, --exclude-namespace and --selector. The
+// alpha policies out of scope are still used to resolve the precedence, but none of their beta policies are generated.
+type scope struct {
+	// namespaces includes the namespaces in scope, nil means all namespaces.
+	namespaces map[string]bool
+	excluded   map[string]bool
+	// selector selects the alpha policies by labels, nil means all policies.
+	selector labels.Selector
+	// policies records whether each alpha policy is in scope, keyed by kind/namespace/name.
+	policies map[string]bool
+}
+
+func newScope() (*scope, error) {
+	s := &scope{excluded: map[string]bool{}, policies: map[string]bool{}}
+	if len(namespaces) != 0 {
+		s.namespaces = map[string]bool{}
+		for _, ns := range namespaces {
+			s.namespaces[ns] = true
+		}
+	}
+	for _, ns := range excludeNamespaces {
+		s.excluded[ns] = true
+	}
+	if policySelector != "" {
+		selector, err := labels.Parse(policySelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --selector %q: %w", policySelector, err)
+		}
+		s.selector = selector
+	}
+	return s, nil
+}
+
+// restricted returns true if any of --namespace, --exclude-namespace and --selector is set.
+func (s *scope) restricted() bool {
+	return s.namespaces != nil || len(s.excluded) != 0 || s.selector != nil
+}
+
+// includesNamespace returns true if the namespace is in scope.
+func (s *scope) includesNamespace(namespace string) bool {
+	return (s.namespaces == nil || s.namespaces[namespace]) && !s.excluded[namespace]
+}
+
+// includesAnyNamespace returns true if any of the namespaces is in scope.
+func (s *scope) includesAnyNamespace(namespaces []string) bool {
+	for _, ns := range namespaces {
+		if s.includesNamespace(ns) {
+			return true
+		}
+	}
+	return false
+}
+
+// includes returns true if the alpha policy is in scope and records the result. The cluster scoped policy (e.g.
+// MeshPolicy) applies to all namespaces and is only restricted by the selector.
+func (s *scope) includes(kind, namespace, name string, policyLabels map[string]string) bool {
+	in := s.selector == nil || s.selector.Matches(labels.Set(policyLabels))
+	if namespace != "" {
+		in = in && s.includesNamespace(namespace)
+	}
+	s.policies[kind+"/"+namespace+"/"+name] = in
+	return in
+}
+
+// includesOutput returns true if the beta policy is in the namespace in scope and is not generated from an alpha policy
+// out of scope.
+func (s *scope) includesOutput(output *converter.OutputPolicy) bool {
+	return s.includesNamespace(output.Namespace) && s.includesSource(output)
+}
+
+// includesSource returns true if the beta policy is not generated from an alpha policy out of scope.
+func (s *scope) includesSource(output *converter.OutputPolicy) bool {
+	source := output.Source
+	in, found := s.policies[source.Kind+"/"+source.Namespace+"/"+source.Name]
+	return in || !found
+}
+
+// namespacesIn returns the namespaces in scope other than the root namespace, either given by --namespace or all
+// namespaces in the cluster (or the input) and the namespaces of the alpha policies. The services are not used as only
+// the services referenced by the policies are loaded.
+func (s *scope) namespacesIn(res *resources) []string {
+	found := map[string]bool{}
+	if s.namespaces != nil {
+		found = s.namespaces
+	} else {
+		for _, ns := range res.namespaces {
+			found[ns] = true
+		}
+		for _, item := range append(res.policies, res.rbac...) {
+			if item.GetNamespace() != "" {
+				found[item.GetNamespace()] = true
+			}
+		}
+	}
+	var ret []string
+	for ns := range found {
+		if ns != res.rootNamespace && s.includesNamespace(ns) {
+			ret = append(ret, ns)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// testScope returns the scope of the flags, the flags are restored when the test ends.
+func testScope(t *testing.T, included, excluded []string, selector string) *scope {
+	defer func(n, e []string, s string) {
+		namespaces, excludeNamespaces, policySelector = n, e, s
+	}(namespaces, excludeNamespaces, policySelector)
+	namespaces, excludeNamespaces, policySelector = included, excluded, selector
+	sc, err := newScope()
+	if err != nil {
+		t.Fatalf("failed to create scope: %v", err)
+	}
+	return sc
+}
+
+func TestScope_Includes(t *testing.T) {
+	type policy struct {
+		kind      string
+		namespace string
+		labels    map[string]string
+		want      bool
+	}
+	cases := []struct {
+		name       string
+		namespaces []string
+		excluded   []string
+		selector   string
+		policies   []policy
+	}{
+		{
+			name: "no-scope",
+			policies: []policy{
+				{kind: "MeshPolicy", want: true},
+				{kind: "Policy", namespace: "foo", want: true},
+			},
+		},
+		{
+			name:       "namespace",
+			namespaces: []string{"foo"},
+			excluded:   []string{"bar"},
+			policies: []policy{
+				{kind: "MeshPolicy", want: true},
+				{kind: "Policy", namespace: "foo", want: true},
+				{kind: "Policy", namespace: "bar"},
+				{kind: "ServiceRoleBinding", namespace: "baz"},
+			},
+		},
+		{
+			name:     "exclude-namespace",
+			excluded: []string{"bar"},
+			policies: []policy{
+				{kind: "Policy", namespace: "foo", want: true},
+				{kind: "Policy", namespace: "bar"},
+			},
+		},
+		{
+			// The cluster scoped policy applies to all namespaces and is only restricted by the selector.
+			name:       "selector",
+			namespaces: []string{"foo"},
+			selector:   "team=foo",
+			policies: []policy{
+				{kind: "MeshPolicy", labels: map[string]string{"team": "foo"}, want: true},
+				{kind: "ClusterRbacConfig"},
+				{kind: "Policy", namespace: "foo", labels: map[string]string{"team": "foo"}, want: true},
+				{kind: "Policy", namespace: "foo", labels: map[string]string{"team": "bar"}},
+				{kind: "Policy", namespace: "bar", labels: map[string]string{"team": "foo"}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sc := testScope(t, tc.namespaces, tc.excluded, tc.selector)
+			for i, p := range tc.policies {
+				name := fmt.Sprintf("policy-%d", i)
+				if got := sc.includes(p.kind, p.namespace, name, p.labels); got != p.want {
+					t.Errorf("%s %s/%s: want in scope %v but got %v", p.kind, p.namespace, name, p.want, got)
+				}
+				out := &converter.OutputPolicy{Name: name, Namespace: "foo",
+					Source: converter.ObjectReference{Kind: p.kind, Namespace: p.namespace, Name: name}}
+				if got := sc.includesSource(out); got != p.want {
+					t.Errorf("%s %s/%s: want source in scope %v but got %v", p.kind, p.namespace, name, p.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestScope_IncludesOutput(t *testing.T) {
+	sc := testScope(t, []string{"foo", "bar"}, []string{"bar"}, "")
+	sc.includes("Policy", "foo", "in", nil)
+	sc.includes("Policy", "baz", "out", nil)
+
+	cases := []struct {
+		name      string
+		namespace string
+		source    string
+		want      bool
+	}{
+		{name: "in-scope", namespace: "foo", source: "in", want: true},
+		{name: "source-out-of-scope", namespace: "foo", source: "out"},
+		{name: "namespace-excluded", namespace: "bar", source: "in"},
+		{name: "source-unknown", namespace: "foo", source: "unknown", want: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			namespace := "foo"
+			if tc.source == "out" {
+				namespace = "baz"
+			}
+			out := &converter.OutputPolicy{Name: tc.name, Namespace: tc.namespace,
+				Source: converter.ObjectReference{Kind: "Policy", Namespace: namespace, Name: tc.source}}
+			if got := sc.includesOutput(out); got != tc.want {
+				t.Errorf("want in scope %v but got %v", tc.want, got)
+			}
+		})
+	}
+
+	if !sc.includesAnyNamespace([]string{"bar", "foo"}) || sc.includesAnyNamespace([]string{"bar", "baz"}) {
+		t.Errorf("want any namespace in scope only if foo is included")
+	}
+}
+
+func TestScope_NamespacesIn(t *testing.T) {
+	policy := func(namespace string) unstructured.Unstructured {
+		item := unstructured.Unstructured{}
+		item.SetNamespace(namespace)
+		return item
+	}
+	res := &resources{
+		rootNamespace: "istio-system",
+		namespaces:    []string{"bar", "foo", "istio-system"},
+		policies:      []unstructured.Unstructured{policy(""), policy("baz")},
+		rbac:          []unstructured.Unstructured{policy("qux")},
+	}
+	cases := []struct {
+		name       string
+		namespaces []string
+		excluded   []string
+		want       []string
+	}{
+		{name: "all", want: []string{"bar", "baz", "foo", "qux"}},
+		{name: "excluded", excluded: []string{"bar"}, want: []string{"baz", "foo", "qux"}},
+		{name: "namespace", namespaces: []string{"foo", "istio-system", "new"}, want: []string{"foo", "new"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sc := testScope(t, tc.namespaces, tc.excluded, "")
+			if got := sc.namespacesIn(res); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want namespaces %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
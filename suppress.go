@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+)
+
+// suppressAnnotation is the annotation on the alpha policy to suppress the issues with the given comma separated codes.
+const suppressAnnotation = "security.istio.io/alpha-policy-convert-suppress"
+
+// suppressions includes the issue codes to suppress, the key is the namespace/name of the alpha policy and the empty
+// key is used for all policies.
+type suppressions map[string]map[converter.IssueCode]bool
+
+// parseSuppressions parses the --suppress flag, each value is either CODE for all policies, namespace/name:CODE for a
+// namespaced policy or name:CODE for a cluster scoped policy (e.g. MeshPolicy).
+func parseSuppressions(values []string) (suppressions, error) {
+	ret := suppressions{}
+	for _, value := range values {
+		target, code := "", value
+		if i := strings.LastIndex(value, ":"); i != -1 {
+			target, code = value[:i], value[i+1:]
+			if !strings.Contains(target, "/") {
+				target = "/" + target
+			}
+		}
+		if err := ret.add(target, code); err != nil {
+			return nil, fmt.Errorf("invalid --suppress value %q: %w", value, err)
+		}
+	}
+	return ret, nil
+}
+
+func (s suppressions) add(key, code string) error {
+	issueCode := converter.IssueCode(strings.TrimSpace(code))
+	if !converter.IsKnownIssueCode(issueCode) {
+		return fmt.Errorf("unknown issue code %q", code)
+	}
+	if s[key] == nil {
+		s[key] = map[converter.IssueCode]bool{}
+	}
+	s[key][issueCode] = true
+	return nil
+}
+
+// codesFor returns the issue codes to suppress for the alpha policy, including the codes in its annotation.
+func (s suppressions) codesFor(namespace, name string, annotations map[string]string) (map[converter.IssueCode]bool, error) {
+	ret := map[converter.IssueCode]bool{}
+	for code := range s[""] {
+		ret[code] = true
+	}
+	for code := range s[namespace+"/"+name] {
+		ret[code] = true
+	}
+	if value := annotations[suppressAnnotation]; value != "" {
+		for _, code := range strings.Split(value, ",") {
+			issueCode := converter.IssueCode(strings.TrimSpace(code))
+			if !converter.IsKnownIssueCode(issueCode) {
+				return nil, fmt.Errorf("unknown issue code %q in annotation %s of %s/%s", code, suppressAnnotation, namespace, name)
+			}
+			ret[issueCode] = true
+		}
+	}
+	return ret, nil
+}
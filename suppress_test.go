@@ -0,0 +1,127 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+)
+
+func TestParseSuppressions(t *testing.T) {
+	cases := []struct {
+		name      string
+		values    []string
+		want      suppressions
+		wantError string
+	}{
+		{
+			name:   "all-policies",
+			values: []string{"PEER_IS_OPTIONAL"},
+			want:   suppressions{"": {converter.CodePeerIsOptional: true}},
+		},
+		{
+			name:   "namespaced-policy",
+			values: []string{"foo/my-policy:SERVICE_NOT_FOUND", "foo/my-policy:PORT_NOT_FOUND"},
+			want:   suppressions{"foo/my-policy": {converter.CodeServiceNotFound: true, converter.CodePortNotFound: true}},
+		},
+		{
+			name:   "cluster-scoped-policy",
+			values: []string{"default:PORT_NOT_FOUND"},
+			want:   suppressions{"/default": {converter.CodePortNotFound: true}},
+		},
+		{
+			name:      "unknown-code",
+			values:    []string{"foo/my-policy:NOT_A_CODE"},
+			wantError: `invalid --suppress value "foo/my-policy:NOT_A_CODE": unknown issue code "NOT_A_CODE"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseSuppressions(tc.values)
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("want error %q but got %v", tc.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want no error but got %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want suppressions %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSuppressions_CodesFor(t *testing.T) {
+	s, err := parseSuppressions([]string{"PEER_IS_OPTIONAL", "foo/my-policy:SERVICE_NOT_FOUND", "default:PORT_NOT_FOUND"})
+	if err != nil {
+		t.Fatalf("failed to parse suppressions: %v", err)
+	}
+	cases := []struct {
+		name        string
+		namespace   string
+		policy      string
+		annotations map[string]string
+		want        []converter.IssueCode
+		wantError   string
+	}{
+		{
+			name:      "namespaced-policy",
+			namespace: "foo",
+			policy:    "my-policy",
+			want:      []converter.IssueCode{converter.CodePeerIsOptional, converter.CodeServiceNotFound},
+		},
+		{
+			name:      "other-policy",
+			namespace: "foo",
+			policy:    "other",
+			want:      []converter.IssueCode{converter.CodePeerIsOptional},
+		},
+		{
+			name:   "mesh-policy",
+			policy: "default",
+			want:   []converter.IssueCode{converter.CodePeerIsOptional, converter.CodePortNotFound},
+		},
+		{
+			name:        "annotation",
+			namespace:   "bar",
+			policy:      "default",
+			annotations: map[string]string{suppressAnnotation: "DUPLICATE_TARGET, JWT_REQUIREMENT_EXPANDED"},
+			want: []converter.IssueCode{converter.CodeDuplicateTarget, converter.CodePeerIsOptional,
+				converter.CodeJWTRequirementExpanded},
+		},
+		{
+			name:        "unknown-code-in-annotation",
+			namespace:   "bar",
+			policy:      "default",
+			annotations: map[string]string{suppressAnnotation: "NOT_A_CODE"},
+			wantError:   `unknown issue code "NOT_A_CODE" in annotation`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s.codesFor(tc.namespace, tc.policy, tc.annotations)
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Fatalf("want error %q but got %v", tc.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want no error but got %v", err)
+			}
+			want := map[converter.IssueCode]bool{}
+			for _, code := range tc.want {
+				want[code] = true
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("want codes %v but got %v", want, got)
+			}
+		})
+	}
+}
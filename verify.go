@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/istio-ecosystem/security-policy-migrate/converter"
+	"github.com/spf13/cobra"
+)
+
+func verifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the converted beta policies are semantically equivalent to the v1alpha1 authentication policy.",
+		Long: `Verify converts each v1alpha1 authentication policy and evaluates representative requests (with and without
+peer certificate and JWT, on each trigger rule path and each port) against both the alpha and the converted beta
+policies locally, any request that has different decision is reported as a mismatch.`,
+		Example: `
+# Verify the conversion of the v1alpha1 authentication policy in the current cluster:
+./convert verify
+
+# Verify the conversion of the v1alpha1 authentication policy in local files and output a JSON report:
+./convert verify --input alpha-policy.yaml --input k8s-services/ --report json --report-file report.json
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := loadResources()
+			if err != nil {
+				return err
+			}
+			return verify(res)
+		},
+	}
+}
+
+func verify(res *resources) (err error) {
+	cvt := newConverter(res)
+	sc, err := newScope()
+	if err != nil {
+		return err
+	}
+	rpt := newReport()
+	if reportFormat != "" {
+		defer func() {
+			if reportErr := rpt.write(reportFormat, reportFile); reportErr != nil && err == nil {
+				err = reportErr
+			}
+		}()
+	}
+
+	for _, item := range res.policies {
+		policy, err := converter.ConvertToPolicy(item)
+		if err != nil {
+			return fmt.Errorf("failed to convert resource to authentication policy: %v", err)
+		}
+		kind, namespace, name := item.GetKind(), item.GetNamespace(), item.GetName()
+		if !sc.includes(kind, namespace, name, item.GetLabels()) {
+			log.Printf("SKIPPED  verifying %s %s/%s, out of scope", kind, namespace, name)
+			rpt.addOutOfScope(kind, namespace, name)
+			continue
+		}
+		output, summary := cvt.Convert(policy)
+		if cnt := len(summary.Errors); cnt != 0 {
+			errorOutput := fmt.Sprintf("\n\t* %s", joinIssues(summary.Errors, "\n\t* "))
+			log.Printf("FAILED   converting %s %s/%s, found %d errors: %s", kind, namespace, name, cnt, errorOutput)
+			rpt.addVerification(kind, namespace, name, output, summary, nil)
+			continue
+		}
+
+		result := cvt.Verify(policy, output)
+		rpt.addVerification(kind, namespace, name, output, summary, result)
+		if cnt := len(result.Errors); cnt != 0 {
+			errorOutput := fmt.Sprintf("\n\t* %s", strings.Join(result.Errors, "\n\t* "))
+			log.Printf("MISMATCH verifying %s %s/%s, could not evaluate the beta policy: %s", kind, namespace, name, errorOutput)
+		} else if cnt := len(result.Mismatches); cnt != 0 {
+			var mismatches []string
+			for _, m := range result.Mismatches {
+				mismatches = append(mismatches, fmt.Sprintf("%s: alpha %s, beta %s", m.Request, m.Alpha, m.Beta))
+			}
+			log.Printf("MISMATCH verifying %s %s/%s, found %d of %d requests with different decision: \n\t* %s",
+				kind, namespace, name, cnt, result.Requests, strings.Join(mismatches, "\n\t* "))
+		} else {
+			log.Printf("VERIFIED %s %s/%s, evaluated %d requests", kind, namespace, name, result.Requests)
+		}
+	}
+
+	if rpt.Summary.Failed != 0 {
+		return fmt.Errorf("verification failed, found %d of %d policies failed or mismatched", rpt.Summary.Failed, rpt.Summary.Total)
+	}
+	return nil
+}